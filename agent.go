@@ -0,0 +1,117 @@
+package nexgenomics
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AgentStatus is the state of an agent's deployment.
+type AgentStatus string
+
+const (
+	AgentStopped   AgentStatus = "stopped"
+	AgentStarting  AgentStatus = "starting"
+	AgentRunning   AgentStatus = "running"
+	AgentStopping  AgentStatus = "stopping"
+	AgentDeploying AgentStatus = "deploying"
+	AgentFailed    AgentStatus = "failed"
+)
+
+// Agent is an agent as stored in the agentstore.
+type Agent struct {
+	Id        string            `json:"id"`
+	Name      string            `json:"name"`
+	Status    AgentStatus       `json:"status,omitempty"`
+	Tenant    string            `json:"tenant,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Model     *ModelConfig      `json:"model,omitempty"`
+	Runtime   *RuntimeConfig    `json:"runtime,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at,omitzero"`
+
+	// Extra holds the fields the server sent that this version of the SDK
+	// does not know, undecoded. They are sent back when the Agent is
+	// marshalled, so they survive a round trip.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// ModelConfig is the model an agent runs.
+type ModelConfig struct {
+	Name       string         `json:"name"`
+	Version    string         `json:"version,omitempty"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+}
+
+// RuntimeConfig is how an agent is run in the Secure Fabric.
+type RuntimeConfig struct {
+	Image    string            `json:"image,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Replicas int               `json:"replicas,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+}
+
+// agent_fields has the same fields as Agent, without its methods.
+type agent_fields Agent
+
+// known_agent_fields is the set of JSON names of Agent's fields.
+var known_agent_fields = sync.OnceValue(func() map[string]bool {
+	known := map[string]bool{}
+	t := reflect.TypeFor[agent_fields]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+	return known
+})
+
+// UnmarshalJSON decodes an Agent, keeping unknown fields in Extra.
+func (a *Agent) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var f agent_fields
+	if e := json.Unmarshal(b, &f); e != nil {
+		return e
+	}
+	var all map[string]json.RawMessage
+	if e := json.Unmarshal(b, &all); e != nil {
+		return e
+	}
+	for k := range all {
+		if known_agent_fields()[k] {
+			delete(all, k)
+		}
+	}
+	f.Extra = nil
+	if len(all) > 0 {
+		f.Extra = all
+	}
+	*a = Agent(f)
+	return nil
+}
+
+// MarshalJSON encodes an Agent, including the fields in Extra. A field of
+// the Agent takes precedence over an Extra of the same name.
+func (a Agent) MarshalJSON() ([]byte, error) {
+	b, e := json.Marshal(agent_fields(a))
+	if e != nil || len(a.Extra) == 0 {
+		return b, e
+	}
+	var all map[string]json.RawMessage
+	if e := json.Unmarshal(b, &all); e != nil {
+		return nil, e
+	}
+	for k, v := range a.Extra {
+		if !known_agent_fields()[k] {
+			all[k] = v
+		}
+	}
+	return json.Marshal(all)
+}
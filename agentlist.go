@@ -0,0 +1,113 @@
+package nexgenomics
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// DefaultPageSize is the number of agents asked for per page when
+// ListAgentsOptions.Limit is zero.
+const DefaultPageSize = 100
+
+// agent_pages_path is the paging endpoint. It always answers with an
+// AgentPage; /api/agents answers with the whole list as an array, as it did
+// before paging, so Agents keeps working.
+const agent_pages_path = "/api/agent-pages"
+
+// AgentSort is the order agents are listed in.
+type AgentSort string
+
+const (
+	SortCreatedAsc  AgentSort = "created_at"
+	SortCreatedDesc AgentSort = "-created_at"
+	SortNameAsc     AgentSort = "name"
+	SortNameDesc    AgentSort = "-name"
+)
+
+// ListAgentsOptions selects a page of agents. The filters are applied by
+// the server. Zero fields are left out of the request.
+type ListAgentsOptions struct {
+	Limit        int       // page size; the server may return fewer
+	Cursor       string    // from AgentPage.NextCursor; empty for the first page
+	NamePrefix   string    // only agents whose name starts with this
+	CreatedAfter time.Time // only agents created after this time
+	Tags         []string  // only agents that have every one of these tags
+	Sort         AgentSort // the server's default is SortCreatedAsc
+}
+
+// AgentPage is one page of agents.
+type AgentPage struct {
+	Agents     []Agent `json:"agents"`
+	NextCursor string  `json:"next_cursor"` // empty on the last page
+}
+
+// ListAgents returns one page of the agents you own.
+func (as *Agentstore) ListAgents(ctx context.Context, opts ListAgentsOptions) (*AgentPage, error) {
+	var page AgentPage
+	if e := as.call(ctx, resty.MethodGet, agent_pages_path+"?"+opts.query().Encode(), nil, &page); e != nil {
+		return nil, e
+	}
+	return &page, nil
+}
+
+// AllAgents iterates over the agents you own, fetching a page at a time as
+// the loop goes. opts.Cursor, if set, is where the iteration starts. If a
+// page cannot be fetched, the iteration ends with the error.
+//
+//	for a, e := range as.AllAgents(ctx, nexgenomics.ListAgentsOptions{NamePrefix: "prod-"}) {
+//		if e != nil {
+//			return e
+//		}
+//		fmt.Println(a.Name)
+//	}
+func (as *Agentstore) AllAgents(ctx context.Context, opts ListAgentsOptions) iter.Seq2[Agent, error] {
+	return func(yield func(Agent, error) bool) {
+		for {
+			page, e := as.ListAgents(ctx, opts)
+			if e != nil {
+				yield(Agent{}, e)
+				return
+			}
+			for _, a := range page.Agents {
+				if !yield(a, nil) {
+					return
+				}
+			}
+			if page.NextCursor == "" {
+				return
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}
+}
+
+// query
+func (o ListAgentsOptions) query() url.Values {
+	q := url.Values{}
+	limit := o.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	q.Set("limit", strconv.Itoa(limit))
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	if o.NamePrefix != "" {
+		q.Set("name_prefix", o.NamePrefix)
+	}
+	if !o.CreatedAfter.IsZero() {
+		q.Set("created_after", o.CreatedAfter.UTC().Format(time.RFC3339Nano))
+	}
+	for _, t := range o.Tags {
+		q.Add("tag", t)
+	}
+	if o.Sort != "" {
+		q.Set("sort", string(o.Sort))
+	}
+	return q
+}
@@ -1,51 +1,53 @@
 package nexgenomics
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
+// DefaultAgentstoreURL is the base URL of the NexGenomics agentstore.
+const DefaultAgentstoreURL = "https://agentstore.nexgenomics.ai"
+
 // Agentstore
 type Agentstore struct {
 	Token string
-}
 
-type Agent struct {
-	Id        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	conn
+	client *Client // the Client that made it, if any
+	poll   time.Duration
 }
 
 // NewAgentstore
-func NewAgentstore(token string) *Agentstore {
+func NewAgentstore(token string, opts ...AgentstoreOption) *Agentstore {
 	a := Agentstore{
 		Token: token,
+		conn:  new_conn("agentstore", DefaultAgentstoreURL),
+	}
+	for _, o := range opts {
+		o.apply_agentstore(&a)
 	}
+	a.finish()
 
 	return &a
 }
 
-// Agents returns a list of the agents you own.
+// Agents returns a list of the agents you own, fetched in one request.
+// For large lists, use AllAgents.
 func (as *Agentstore) Agents() ([]Agent, error) {
 
-	c := resty.New()
-	resp, e := c.R().
-		SetHeader("Authorization", fmt.Sprintf("Bearer %s", as.Token)).
-		SetResult(&[]Agent{}).
-		Get("https://agentstore.nexgenomics.ai/api/agents")
+	resp, e := as.execute(context.Background(), as.token_source(as.Token), resty.MethodGet, as.url("/api/agents"), func(req *resty.Request) {
+		req.SetResult(&[]Agent{})
+	})
 
 	if e != nil {
 		return nil, e
 	}
 
-	if sc := resp.StatusCode(); sc == 403 {
-		return nil, fmt.Errorf("unauthorized")
-	} else if sc != 200 {
-		return nil, fmt.Errorf("failed with status %d", sc)
-	}
-
 	if agents, ok := resp.Result().(*[]Agent); ok {
 		return *agents, nil
 	} else {
@@ -53,3 +55,100 @@ func (as *Agentstore) Agents() ([]Agent, error) {
 	}
 
 }
+
+// CreateAgentRequest describes an agent to create.
+type CreateAgentRequest struct {
+	Name    string            `json:"name"`
+	Tags    []string          `json:"tags,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Model   *ModelConfig      `json:"model,omitempty"`
+	Runtime *RuntimeConfig    `json:"runtime,omitempty"`
+}
+
+// UpdateAgentRequest describes changes to an agent. Nil fields are left as
+// they are. Labels are merged into the agent's, and a label set to the
+// empty string is removed.
+type UpdateAgentRequest struct {
+	Name    *string           `json:"name,omitempty"`
+	Tags    *[]string         `json:"tags,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Model   *ModelConfig      `json:"model,omitempty"`
+	Runtime *RuntimeConfig    `json:"runtime,omitempty"`
+}
+
+// CreateAgent creates an agent and returns it as stored.
+func (as *Agentstore) CreateAgent(ctx context.Context, req CreateAgentRequest) (*Agent, error) {
+	var a Agent
+	if e := as.call(ctx, resty.MethodPost, "/api/agents", req, &a); e != nil {
+		return nil, e
+	}
+	return &a, nil
+}
+
+// GetAgent returns the agent with the given id. An agent that does not
+// exist is an error matching ErrNotFound.
+func (as *Agentstore) GetAgent(ctx context.Context, id string) (*Agent, error) {
+	var a Agent
+	if e := as.call(ctx, resty.MethodGet, agent_path(id), nil, &a); e != nil {
+		return nil, e
+	}
+	return &a, nil
+}
+
+// UpdateAgent changes an agent and returns it as stored.
+func (as *Agentstore) UpdateAgent(ctx context.Context, id string, req UpdateAgentRequest) (*Agent, error) {
+	var a Agent
+	if e := as.call(ctx, resty.MethodPatch, agent_path(id), req, &a); e != nil {
+		return nil, e
+	}
+	return &a, nil
+}
+
+// DeleteAgent deletes an agent.
+func (as *Agentstore) DeleteAgent(ctx context.Context, id string) error {
+	return as.call(ctx, resty.MethodDelete, agent_path(id), nil, nil)
+}
+
+// agent_path
+func agent_path(id string) string {
+	return "/api/agents/" + url.PathEscape(id)
+}
+
+// call makes a JSON request to the agentstore. body, if not nil, is sent
+// as the request body, and the response body is decoded into result, if
+// not nil.
+func (as *Agentstore) call(ctx context.Context, method string, path string, body any, result any) error {
+	var j []byte
+	if body != nil {
+		var e error
+		if j, e = json.Marshal(body); e != nil {
+			return e
+		}
+	}
+
+	resp, e := as.execute(ctx, as.token_source(as.Token), method, as.url(path), func(req *resty.Request) {
+		req.SetHeader("Accept", "application/json")
+		if j != nil {
+			req.SetHeader("Content-Type", "application/json").SetBody(j)
+		}
+	})
+	if e != nil {
+		return e
+	}
+
+	if result != nil {
+		if e := json.Unmarshal(resp.Body(), result); e != nil {
+			return fmt.Errorf("decoding response: %w", e)
+		}
+	}
+	return nil
+}
+
+// url
+func (as *Agentstore) url(path string) string {
+	base := as.baseurl
+	if base == "" {
+		base = DefaultAgentstoreURL
+	}
+	return base + path
+}
@@ -1,23 +1,28 @@
 package nexgenomics_test
 
 import (
-	"os"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/nexgenomics/go-nexgenomics"
+	"github.com/nexgenomics/go-nexgenomics/nexgenomicstest"
 )
 
-var (
-	AGENTSTORE_TOKEN string
-)
-
-func init() {
-	AGENTSTORE_TOKEN = os.Getenv("AGENTSTORE_TOKEN")
-}
-
 func TestNewAgentstore(t *testing.T) {
-	t.Logf("agentstore token [%s]", AGENTSTORE_TOKEN)
-	as := nexgenomics.NewAgentstore(AGENTSTORE_TOKEN)
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	srv.AllowTokens("agentstore-token")
+	srv.SetAgents(
+		nexgenomics.Agent{Id: "a1", Name: "first", CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)},
+		nexgenomics.Agent{Id: "a2", Name: "second"},
+	)
+
+	as := nexgenomics.NewAgentstore("agentstore-token", srv.AgentstoreOptions()...)
 
 	agents, e := as.Agents()
 	if e != nil {
@@ -25,6 +30,225 @@ func TestNewAgentstore(t *testing.T) {
 	}
 
 	for i, a := range agents {
-		t.Logf("%d) %s", i, a)
+		t.Logf("%d) %v", i, a)
+	}
+	if len(agents) != 2 || agents[0].Id != "a1" || agents[1].Name != "second" {
+		t.Errorf("unexpected agents %v", agents)
+	}
+}
+
+func TestAgentCRUD(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	as := nexgenomics.NewAgentstore("agentstore-token", srv.AgentstoreOptions()...)
+	ctx := context.Background()
+
+	a, e := as.CreateAgent(ctx, nexgenomics.CreateAgentRequest{Name: "first"})
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	if a.Id == "" || a.Name != "first" || a.CreatedAt.IsZero() {
+		t.Errorf("unexpected agent %+v", a)
+	}
+
+	name := "renamed"
+	if u, e := as.UpdateAgent(ctx, a.Id, nexgenomics.UpdateAgentRequest{Name: &name}); e != nil || u.Name != name {
+		t.Errorf("update: %+v, %v", u, e)
+	}
+	if g, e := as.GetAgent(ctx, a.Id); e != nil || g.Name != name || !g.CreatedAt.Equal(a.CreatedAt) {
+		t.Errorf("get: %+v, %v", g, e)
+	}
+
+	if e := as.DeleteAgent(ctx, a.Id); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if _, e := as.GetAgent(ctx, a.Id); !errors.Is(e, nexgenomics.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", e)
+	}
+
+	var api *nexgenomics.APIError
+	if _, e := as.CreateAgent(ctx, nexgenomics.CreateAgentRequest{}); !errors.As(e, &api) || api.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a 400 for a nameless agent, got %v", e)
+	}
+}
+
+func TestAllAgents(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	srv.SetAgents(
+		nexgenomics.Agent{Id: "a1", Name: "prod-b", CreatedAt: day(1), Tags: []string{"eu"}},
+		nexgenomics.Agent{Id: "a2", Name: "test-a", CreatedAt: day(2), Tags: []string{"eu"}},
+		nexgenomics.Agent{Id: "a3", Name: "prod-a", CreatedAt: day(3), Tags: []string{"eu", "gpu"}},
+		nexgenomics.Agent{Id: "a4", Name: "prod-c", CreatedAt: day(4)},
+		nexgenomics.Agent{Id: "a5", Name: "prod-d", CreatedAt: day(5), Tags: []string{"gpu"}},
+	)
+	as := nexgenomics.NewAgentstore("agentstore-token", srv.AgentstoreOptions()...)
+	ctx := context.Background()
+
+	ids := func(opts nexgenomics.ListAgentsOptions) (out []string) {
+		for a, e := range as.AllAgents(ctx, opts) {
+			if e != nil {
+				t.Fatalf("%s", e)
+			}
+			out = append(out, a.Id)
+		}
+		return out
+	}
+
+	if got := ids(nexgenomics.ListAgentsOptions{Limit: 2}); !slices.Equal(got, []string{"a1", "a2", "a3", "a4", "a5"}) {
+		t.Errorf("all agents: %v", got)
+	}
+	if n := len(srv.Requests()); n != 3 {
+		t.Errorf("expected 3 pages, got %d requests", n)
+	}
+
+	got := ids(nexgenomics.ListAgentsOptions{Limit: 1, NamePrefix: "prod-", CreatedAfter: day(1), Sort: nexgenomics.SortNameDesc})
+	if !slices.Equal(got, []string{"a5", "a4", "a3"}) {
+		t.Errorf("filtered agents: %v", got)
+	}
+	if got := ids(nexgenomics.ListAgentsOptions{Tags: []string{"eu", "gpu"}}); !slices.Equal(got, []string{"a3"}) {
+		t.Errorf("tagged agents: %v", got)
+	}
+
+	// breaking out of the loop stops fetching.
+	srv.Reset()
+	for range as.AllAgents(ctx, nexgenomics.ListAgentsOptions{Limit: 2}) {
+		break
+	}
+	if n := len(srv.Requests()); n != 1 {
+		t.Errorf("expected 1 request after break, got %d", n)
+	}
+
+	srv.Fail(nexgenomicstest.Failure{Path: "/api/agent-pages", Status: http.StatusBadGateway})
+	for _, e := range as.AllAgents(ctx, nexgenomics.ListAgentsOptions{}) {
+		if e == nil {
+			t.Errorf("expected an error")
+		}
+	}
+}
+
+func TestAgentTokens(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	srv.AllowTokens("agentstore-token")
+	c := nexgenomics.NewClient(append(srv.ClientOptions(), nexgenomics.WithToken("agentstore-token"))...)
+	as := c.Agentstore()
+	ctx := context.Background()
+
+	a, e := as.CreateAgent(ctx, nexgenomics.CreateAgentRequest{Name: "ingest"})
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	tok, e := as.CreateToken(ctx, a.Id, []string{nexgenomics.ScopeSentencesWrite}, time.Hour)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	if tok.Token == "" || tok.AgentId != a.Id || tok.ExpiresAt.Sub(tok.CreatedAt) != time.Hour {
+		t.Errorf("unexpected token %+v", tok)
+	}
+
+	wh, e := as.AgentWebhook(ctx, a.Id, 0)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := wh.SendSentences("hello"); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	tokens, e := as.ListTokens(ctx, a.Id)
+	if e != nil || len(tokens) != 2 || tokens[0].Token != "" || !tokens[1].ExpiresAt.IsZero() {
+		t.Fatalf("unexpected tokens %+v, %v", tokens, e)
+	}
+
+	if e := as.RevokeToken(ctx, a.Id, tokens[1].Id); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := wh.SendSentences("again"); !errors.Is(e, nexgenomics.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized with a revoked token, got %v", e)
+	}
+	if e := as.RevokeToken(ctx, a.Id, tokens[1].Id); !errors.Is(e, nexgenomics.ErrNotFound) {
+		t.Errorf("expected ErrNotFound revoking twice, got %v", e)
+	}
+}
+
+func TestAgentWebhookWithoutClient(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	ctx := context.Background()
+
+	// the Webhook goes to the Agentstore's host, not to production.
+	as := nexgenomics.NewAgentstore("agentstore-token", srv.AgentstoreOptions()...)
+	a, e := as.CreateAgent(ctx, nexgenomics.CreateAgentRequest{Name: "ingest"})
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	wh, e := as.AgentWebhook(ctx, a.Id, time.Hour)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := wh.SendSentences("hello"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if got := srv.Sentences(); len(got) != 1 || got[0] != "hello" {
+		t.Errorf("unexpected sentences %q", got)
+	}
+}
+
+func TestAgentModel(t *testing.T) {
+	// fields the SDK does not know survive decoding and encoding.
+	in := `{"id":"a1","name":"one","status":"running","labels":{"team":"genomics"},
+		"model":{"name":"nx-embed","parameters":{"dim":768}},"created_at":"2025-01-02T03:04:05Z",
+		"region":"eu-west","quota":{"sentences":1000}}`
+	var a nexgenomics.Agent
+	if e := json.Unmarshal([]byte(in), &a); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if a.Status != nexgenomics.AgentRunning || a.Labels["team"] != "genomics" || a.Model.Name != "nx-embed" {
+		t.Errorf("unexpected agent %+v", a)
+	}
+	if len(a.Extra) != 2 || string(a.Extra["region"]) != `"eu-west"` {
+		t.Errorf("unexpected extra fields %v", a.Extra)
+	}
+
+	out, e := json.Marshal(a)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	var back map[string]any
+	json.Unmarshal(out, &back)
+	if back["region"] != "eu-west" || back["name"] != "one" || back["quota"] == nil {
+		t.Errorf("extra fields lost in %s", out)
+	}
+
+	// through the agentstore.
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	srv.SetAgents(a)
+	as := nexgenomics.NewAgentstore("agentstore-token", srv.AgentstoreOptions()...)
+	ctx := context.Background()
+
+	g, e := as.GetAgent(ctx, "a1")
+	if e != nil || string(g.Extra["region"]) != `"eu-west"` {
+		t.Errorf("get: %+v, %v", g, e)
+	}
+
+	c, e := as.CreateAgent(ctx, nexgenomics.CreateAgentRequest{
+		Name:    "two",
+		Labels:  map[string]string{"team": "ops", "tier": "gold"},
+		Runtime: &nexgenomics.RuntimeConfig{Image: "agent:1", Replicas: 2},
+	})
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	tags := []string{"eu"}
+	u, e := as.UpdateAgent(ctx, c.Id, nexgenomics.UpdateAgentRequest{Tags: &tags, Labels: map[string]string{"tier": ""}})
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	if u.Status != nexgenomics.AgentStopped || u.Tenant != nexgenomicstest.Tenant || u.Runtime.Replicas != 2 ||
+		!slices.Equal(u.Tags, tags) || len(u.Labels) != 1 || u.UpdatedAt.Before(u.CreatedAt) || u.Extra != nil {
+		t.Errorf("unexpected agent %+v", u)
 	}
 }
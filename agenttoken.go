@@ -0,0 +1,90 @@
+package nexgenomics
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ScopeSentencesWrite lets a token upload sentences through the Webhook.
+const ScopeSentencesWrite = "sentences:write"
+
+// AgentToken is an authorization token belonging to an agent. Token, the
+// secret itself, is only returned when the token is created.
+type AgentToken struct {
+	Id        string    `json:"id"`
+	AgentId   string    `json:"agent_id"`
+	Token     string    `json:"token,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // zero if the token does not expire
+}
+
+// create_token_request
+type create_token_request struct {
+	Scopes     []string `json:"scopes"`
+	TTLSeconds int64    `json:"ttl_seconds,omitempty"`
+}
+
+// CreateToken creates a token for an agent, limited to scopes. A ttl of
+// zero makes a token that does not expire.
+func (as *Agentstore) CreateToken(ctx context.Context, agentID string, scopes []string, ttl time.Duration) (*AgentToken, error) {
+	req := create_token_request{Scopes: scopes}
+	if ttl > 0 {
+		req.TTLSeconds = int64((ttl + time.Second - 1) / time.Second)
+	}
+	var t AgentToken
+	if e := as.call(ctx, resty.MethodPost, agent_path(agentID)+"/tokens", req, &t); e != nil {
+		return nil, e
+	}
+	return &t, nil
+}
+
+// ListTokens returns an agent's tokens, without their secrets.
+func (as *Agentstore) ListTokens(ctx context.Context, agentID string) ([]AgentToken, error) {
+	tokens := []AgentToken{}
+	if e := as.call(ctx, resty.MethodGet, agent_path(agentID)+"/tokens", nil, &tokens); e != nil {
+		return nil, e
+	}
+	return tokens, nil
+}
+
+// RevokeToken revokes one of an agent's tokens.
+func (as *Agentstore) RevokeToken(ctx context.Context, agentID string, tokenID string) error {
+	return as.call(ctx, resty.MethodDelete, agent_path(agentID)+"/tokens/"+url.PathEscape(tokenID), nil, nil)
+}
+
+// AgentWebhook creates a token for an agent that can upload sentences, and
+// returns a Webhook that uses it. Each call creates a new token, so keep
+// the Webhook rather than calling this per upload. An Agentstore from a
+// Client returns a Webhook that shares the Client's configuration. Any
+// other Agentstore passes on its own: the Webhook uses the same transport,
+// retry policy, timeout, logger and telemetry, and an Agentstore given
+// WithBaseURL sends the Webhook to the same host. opts are applied on top.
+func (as *Agentstore) AgentWebhook(ctx context.Context, agentID string, ttl time.Duration, opts ...WebhookOption) (*Webhook, error) {
+	t, e := as.CreateToken(ctx, agentID, []string{ScopeSentencesWrite}, ttl)
+	if e != nil {
+		return nil, e
+	}
+	if as.client != nil {
+		return as.client.Webhook(t.Token, opts...), nil
+	}
+
+	wh := &Webhook{
+		Token: t.Token,
+		conn:  as.conn,
+	}
+	wh.service = "webhook"
+	if wh.baseurl == DefaultAgentstoreURL {
+		wh.baseurl = DefaultWebhookURL
+	}
+	// the Agentstore's token source is not the agent's.
+	wh.tokens = nil
+	for _, o := range opts {
+		o.apply_webhook(wh)
+	}
+	as.finish_sub(&wh.conn)
+	return wh, nil
+}
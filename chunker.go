@@ -0,0 +1,88 @@
+package nexgenomics
+
+import (
+	"bytes"
+)
+
+// compressed_ratio_guess is the compression ratio assumed for the first
+// chunk of a compressed upload, before any text has been measured. It is
+// deliberately low; the chunker adapts to the ratio it observes.
+const compressed_ratio_guess = 2.0
+
+// chunk is a run of records sent as one request body.
+type chunk struct {
+	SentenceRange
+	body []byte // framed and, if enabled, compressed
+}
+
+// chunker splits a batch into request bodies no larger than limit. The limit
+// applies to the body as sent, which is the compressed size when compression
+// is enabled. Every record in the batch must fit in a chunk by itself, which
+// encode_texts guarantees.
+type chunker struct {
+	*batch
+	compression Compression
+	limit       int
+	pos         int
+	ratio       float64
+}
+
+// flush_threshold is the amount of buffered, uncompressed text at which a
+// SentenceWriter sends. Compressed bodies are far smaller than the text they
+// carry, so the writer buffers more and lets the chunker split it.
+func (wh *Webhook) flush_threshold() int {
+	if wh.compression == CompressionNone {
+		return wh.max_chunk()
+	}
+	return int(float64(wh.max_chunk()) * compressed_ratio_guess)
+}
+
+// new_chunker
+func (wh *Webhook) new_chunker(b *batch) *chunker {
+	return &chunker{
+		batch:       b,
+		compression: wh.compression,
+		limit:       wh.max_chunk(),
+		ratio:       compressed_ratio_guess,
+	}
+}
+
+// next returns the next chunk, or false when every record has been chunked.
+func (c *chunker) next() (chunk, bool, error) {
+	if c.pos >= len(c.records) {
+		return chunk{}, false, nil
+	}
+
+	// Uncompressed, a chunk takes every record that fits. Compressed, we aim
+	// at the limit scaled by the observed ratio and back off if the guess
+	// was too generous.
+	budget := c.limit
+	if c.compression != CompressionNone {
+		budget = int(float64(c.limit) * c.ratio * 0.9)
+	}
+
+	end := c.pos + 1
+	bloblen := len(c.records[c.pos])
+	for end < len(c.records) && bloblen+len(c.sep)+len(c.records[end]) <= budget {
+		bloblen += len(c.sep) + len(c.records[end])
+		end++
+	}
+
+	for {
+		raw := bytes.Join(c.records[c.pos:end], c.sep)
+		body, e := c.compression.compress(raw)
+		if e != nil {
+			return chunk{}, false, e
+		}
+		if c.compression != CompressionNone && len(body) > 0 {
+			c.ratio = float64(len(raw)) / float64(len(body))
+		}
+
+		if len(body) <= c.limit || end-c.pos == 1 {
+			ch := chunk{SentenceRange: SentenceRange{Start: c.pos, End: end}, body: body}
+			c.pos = end
+			return ch, true, nil
+		}
+		end = c.pos + (end-c.pos)/2
+	}
+}
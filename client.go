@@ -0,0 +1,118 @@
+package nexgenomics
+
+// Environment names the service URLs of a NexGenomics deployment.
+type Environment struct {
+	WebhookURL    string
+	AgentstoreURL string
+}
+
+// Production is the public NexGenomics cloud. It is the default environment.
+var Production = Environment{
+	WebhookURL:    DefaultWebhookURL,
+	AgentstoreURL: DefaultAgentstoreURL,
+}
+
+// Client holds the configuration shared by the cloud clients, so it is
+// given once: the environment, transport, retry policy, logger and
+// telemetry. The Webhooks and Agentstores it returns share its HTTP client
+// and therefore its connection pool.
+type Client struct {
+	conn
+	env   Environment
+	token string
+}
+
+// ClientOption configures a Client created by NewClient. Every Option is
+// also a ClientOption, and applies to every sub-client. WithBaseURL points
+// all of them at the same host; WithEnvironment sets one URL per service.
+type ClientOption interface {
+	apply_client(*Client)
+}
+
+func (o Option) apply_client(c *Client) { o(&c.conn) }
+
+// client_option is a ClientOption that only makes sense for a Client.
+type client_option func(*Client)
+
+func (o client_option) apply_client(c *Client) { o(c) }
+
+// WithEnvironment selects the deployment the Client talks to.
+func WithEnvironment(env Environment) ClientOption {
+	return client_option(func(c *Client) {
+		c.env = env
+	})
+}
+
+// WithToken sets the token the Client's Agentstore authorizes with.
+// WithTokenSource may be used instead. Webhooks take their agent's token
+// from Client.Webhook.
+func WithToken(token string) ClientOption {
+	return client_option(func(c *Client) {
+		c.token = token
+	})
+}
+
+// NewClient returns a Client.
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		conn: new_conn("", ""),
+		env:  Production,
+	}
+	for _, o := range opts {
+		o.apply_client(c)
+	}
+	c.finish()
+	return c
+}
+
+// Agentstore returns an Agentstore that uses the Client's configuration.
+// opts are applied on top of it.
+func (c *Client) Agentstore(opts ...AgentstoreOption) *Agentstore {
+	as := &Agentstore{
+		Token:  c.token,
+		conn:   c.sub("agentstore", c.env.AgentstoreURL),
+		client: c,
+	}
+	for _, o := range opts {
+		o.apply_agentstore(as)
+	}
+	c.finish_sub(&as.conn)
+	return as
+}
+
+// Webhook returns a Webhook for the agent that agentToken belongs to, using
+// the Client's configuration. opts are applied on top of it.
+func (c *Client) Webhook(agentToken string, opts ...WebhookOption) *Webhook {
+	wh := &Webhook{
+		Token: agentToken,
+		conn:  c.sub("webhook", c.env.WebhookURL),
+	}
+	// the Client's token source belongs to the Agentstore.
+	wh.tokens = nil
+	for _, o := range opts {
+		o.apply_webhook(wh)
+	}
+	c.finish_sub(&wh.conn)
+	return wh
+}
+
+// sub returns the Client's settings for the named service, which lives at
+// baseurl unless the Client was given WithBaseURL.
+func (c *Client) sub(service string, baseurl string) conn {
+	s := c.conn
+	s.service = service
+	if s.baseurl == "" {
+		s.baseurl = baseurl
+	}
+	return s
+}
+
+// finish_sub completes the settings of a sub-client copied from c. The
+// shared HTTP client is kept unless the sub-client was given transport
+// options of its own.
+func (c *conn) finish_sub(s *conn) {
+	if s.transport != c.transport && s.client == c.client {
+		s.client = nil
+	}
+	s.finish()
+}
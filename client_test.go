@@ -0,0 +1,58 @@
+package nexgenomics_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+	"github.com/nexgenomics/go-nexgenomics/nexgenomicstest"
+)
+
+func TestClient(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	srv.AllowTokens("store-token", "agent-token")
+	srv.SetAgents(nexgenomics.Agent{Id: "a1", Name: "one"})
+
+	opts := append(srv.ClientOptions(),
+		nexgenomics.WithToken("store-token"),
+		nexgenomics.WithUserAgent("provisioner"),
+		nexgenomics.WithRetry(nexgenomics.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+	)
+	c := nexgenomics.NewClient(opts...)
+
+	agents, e := c.Agentstore().Agents()
+	if e != nil || len(agents) != 1 {
+		t.Fatalf("expected one agent, got %v, %v", agents, e)
+	}
+
+	// the retry policy is shared, and the webhook uses the agent's token.
+	srv.Fail(nexgenomicstest.Failure{Path: "/wh/sentences", Status: http.StatusServiceUnavailable})
+	if e := c.Webhook("agent-token").SendSentences("hello"); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	want := []string{"store-token", "agent-token", "agent-token"}
+	reqs := srv.Requests()
+	if len(reqs) != len(want) {
+		t.Fatalf("expected %d requests, got %d", len(want), len(reqs))
+	}
+	for i, r := range reqs {
+		if r.Header.Get("Authorization") != "Bearer "+want[i] || r.Header.Get("User-Agent") != "provisioner" {
+			t.Errorf("request %d: unexpected headers %v", i, r.Header)
+		}
+	}
+
+	// options given to a sub-client apply to it alone.
+	if e := c.Webhook("agent-token", nexgenomics.WithUserAgent("other")).SendSentences("again"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := c.Webhook("agent-token").SendSentences("again"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	reqs = srv.Requests()
+	if ua := reqs[len(reqs)-1].Header.Get("User-Agent"); ua != "provisioner" {
+		t.Errorf("sub-client option leaked into the Client: %q", ua)
+	}
+}
@@ -0,0 +1,84 @@
+package nexgenomics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how upload bodies are compressed.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+// WithCompression compresses each chunk the Webhook sends and sets the
+// matching Content-Encoding. Chunks are then sized by their compressed
+// length, so each request carries considerably more text.
+func WithCompression(c Compression) WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.compression = c
+	})
+}
+
+// String
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return "unknown"
+	}
+}
+
+// content_encoding returns the Content-Encoding header value, or "" for
+// uncompressed bodies.
+func (c Compression) content_encoding() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// zstd encoders are expensive to build, but EncodeAll is safe for concurrent
+// use, so one is shared by every Webhook.
+var (
+	zstd_once    sync.Once
+	zstd_encoder *zstd.Encoder
+)
+
+// compress
+func (c Compression) compress(b []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, e := zw.Write(b); e != nil {
+			return nil, e
+		}
+		if e := zw.Close(); e != nil {
+			return nil, e
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		zstd_once.Do(func() {
+			zstd_encoder, _ = zstd.NewWriter(nil)
+		})
+		return zstd_encoder.EncodeAll(b, nil), nil
+	default:
+		return b, nil
+	}
+}
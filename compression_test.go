@@ -0,0 +1,68 @@
+package nexgenomics_test
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+func TestCompression(t *testing.T) {
+	sentences := []string{}
+	for i := range 4000 {
+		sentences = append(sentences, fmt.Sprintf("Sentence %d describes variant rs%d on chromosome %d. %s", i, i*7919, i%23, strings.Repeat("ACGT", 100)))
+	}
+
+	for _, c := range []nexgenomics.Compression{nexgenomics.CompressionGzip, nexgenomics.CompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			got := []string{}
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				body, _ := io.ReadAll(r.Body)
+				if len(body) > 500_000 {
+					t.Errorf("body of %d bytes exceeds the limit", len(body))
+				}
+
+				var rd io.Reader
+				switch r.Header.Get("Content-Encoding") {
+				case "gzip":
+					rd, _ = gzip.NewReader(strings.NewReader(string(body)))
+				case "zstd":
+					zr, _ := zstd.NewReader(strings.NewReader(string(body)))
+					defer zr.Close()
+					rd = zr
+				default:
+					t.Errorf("unexpected encoding %q", r.Header.Get("Content-Encoding"))
+					return
+				}
+				raw, e := io.ReadAll(rd)
+				if e != nil {
+					t.Errorf("%s", e)
+				}
+				got = append(got, strings.Split(string(raw), "\n")...)
+			}))
+			defer srv.Close()
+
+			h := nexgenomics.NewWebhook("abc",
+				nexgenomics.WithBaseURL(srv.URL),
+				nexgenomics.WithCompression(c))
+			if e := h.SendSentences(sentences...); e != nil {
+				t.Fatalf("%s", e)
+			}
+			if len(got) != len(sentences) || got[len(got)-1] != sentences[len(sentences)-1] {
+				t.Errorf("received %d sentences, sent %d", len(got), len(sentences))
+			}
+			// uncompressed, this would take four requests.
+			if requests > 2 {
+				t.Errorf("expected at most 2 requests, got %d", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package nexgenomics
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// DedupStore remembers the content hashes of sentences that have already
+// been sent. Use one store per agent. Implementations must be safe for
+// concurrent use.
+type DedupStore interface {
+	Contains(h [32]byte) bool
+	Add(h [32]byte) error
+}
+
+// WithDedup skips sentences whose content is already in store, and adds
+// each sentence to store once every chunk carrying it has been accepted.
+// Duplicates within a single call or a SentenceWriter's buffer are skipped
+// too. Structured records are compared with their metadata, so the same
+// text from two documents is not a duplicate. The number skipped is
+// reported by Webhook.DuplicatesSkipped.
+func WithDedup(store DedupStore) WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.dedup = store
+	})
+}
+
+// DuplicatesSkipped returns how many sentences the Webhook has skipped
+// because they had already been sent.
+func (wh *Webhook) DuplicatesSkipped() int64 {
+	return wh.skipped.Load()
+}
+
+// content_hash
+func content_hash(record []byte) [32]byte {
+	return sha256.Sum256(record)
+}
+
+// mark_sent records the sentences in the accepted ranges of records in the
+// dedup store. A split sentence is only recorded if every one of its pieces
+// was accepted, since chunks sent concurrently can fail in any order.
+// The chunks have been delivered either way, so a store that cannot record
+// them does not fail the upload; the error is logged, and a FileDedup also
+// reports it from Close.
+func (wh *Webhook) mark_sent(b *batch, accepted []SentenceRange) {
+	if wh.dedup == nil {
+		return
+	}
+	// every piece of a split sentence has the same hash, and no other
+	// record in the batch does.
+	done := make([]bool, len(b.hashes))
+	for _, r := range accepted {
+		for i := r.Start; i < r.End && i < len(done); i++ {
+			done[i] = true
+		}
+	}
+	complete := map[[32]byte]bool{}
+	for i, h := range b.hashes {
+		if h != ([32]byte{}) {
+			if ok, found := complete[h]; found {
+				complete[h] = ok && done[i]
+			} else {
+				complete[h] = done[i]
+			}
+		}
+	}
+
+	var errs []error
+	for i, h := range b.hashes {
+		if complete[h] && (i+1 == len(b.hashes) || b.hashes[i+1] != h) {
+			if e := wh.dedup.Add(h); e != nil {
+				errs = append(errs, e)
+			}
+		}
+	}
+	if len(errs) > 0 && wh.logger != nil {
+		wh.logger.Warn("dedup store failed to record sent sentences", "sentences", len(errs), "error", errors.Join(errs...))
+	}
+}
+
+// MemoryDedup is a DedupStore that keeps the most recently added hashes in
+// memory, forgetting the least recently used once it holds capacity of them.
+type MemoryDedup struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[[32]byte]*list.Element
+}
+
+// NewMemoryDedup returns a MemoryDedup holding up to capacity hashes.
+func NewMemoryDedup(capacity int) *MemoryDedup {
+	return &MemoryDedup{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		items:    map[[32]byte]*list.Element{},
+	}
+}
+
+// Contains also counts as a use of h.
+func (m *MemoryDedup) Contains(h [32]byte) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[h]; ok {
+		m.order.MoveToFront(el)
+		return true
+	}
+	return false
+}
+
+// Add
+func (m *MemoryDedup) Add(h [32]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(h)
+	return nil
+}
+
+// add ASSUMES the lock is held. It reports whether h was new.
+func (m *MemoryDedup) add(h [32]byte) bool {
+	if el, ok := m.items[h]; ok {
+		m.order.MoveToFront(el)
+		return false
+	}
+	m.items[h] = m.order.PushFront(h)
+	for m.order.Len() > m.capacity {
+		el := m.order.Back()
+		m.order.Remove(el)
+		delete(m.items, el.Value.([32]byte))
+	}
+	return true
+}
+
+// FileDedup is a MemoryDedup that is persisted to a file, so it survives
+// restarts. Hashes are appended to the file as they are added, and the file
+// is rewritten with just the retained hashes when it grows to twice the
+// capacity.
+//
+// Once a write to the file fails, hashes are only kept in memory and every
+// Add, and Close, returns the error, since what is on disk is no longer
+// complete.
+type FileDedup struct {
+	*MemoryDedup
+	path    string
+	f       *os.File
+	written int
+	err     error
+}
+
+// NewFileDedup opens or creates the store at path, holding up to capacity hashes.
+func NewFileDedup(path string, capacity int) (*FileDedup, error) {
+	d := &FileDedup{
+		MemoryDedup: NewMemoryDedup(capacity),
+		path:        path,
+	}
+
+	if f, e := os.Open(path); e == nil {
+		rd := bufio.NewReader(f)
+		var h [32]byte
+		for {
+			if _, e := io.ReadFull(rd, h[:]); e != nil {
+				break
+			}
+			d.MemoryDedup.add(h)
+			d.written++
+		}
+		f.Close()
+	} else if !os.IsNotExist(e) {
+		return nil, e
+	}
+
+	f, e := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if e != nil {
+		return nil, e
+	}
+	d.f = f
+	return d, nil
+}
+
+// Add
+func (d *FileDedup) Add(h [32]byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.add(h) {
+		return d.err
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if _, e := d.f.Write(h[:]); e != nil {
+		d.err = e
+		return e
+	}
+	d.written++
+	if d.written >= 2*d.capacity {
+		d.err = d.compact()
+	}
+	return d.err
+}
+
+// compact rewrites the file with the retained hashes, oldest first. It
+// ASSUMES the lock is held.
+func (d *FileDedup) compact() error {
+	tmp := d.path + ".tmp"
+	f, e := os.Create(tmp)
+	if e != nil {
+		return e
+	}
+	w := bufio.NewWriter(f)
+	for el := d.order.Back(); el != nil; el = el.Prev() {
+		h := el.Value.([32]byte)
+		w.Write(h[:])
+	}
+	if e := w.Flush(); e != nil {
+		f.Close()
+		return e
+	}
+	if e := f.Close(); e != nil {
+		return e
+	}
+	if e := os.Rename(tmp, d.path); e != nil {
+		return e
+	}
+
+	d.f.Close()
+	if d.f, e = os.OpenFile(d.path, os.O_WRONLY|os.O_APPEND, 0o644); e != nil {
+		d.f = nil
+		return e
+	}
+	d.written = d.order.Len()
+	return nil
+}
+
+// Close closes the file. It also returns the error that stopped the file
+// being written, if there was one.
+func (d *FileDedup) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil {
+		return d.err
+	}
+	return errors.Join(d.err, d.f.Close())
+}
@@ -0,0 +1,169 @@
+package nexgenomics_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nexgenomics/go-nexgenomics"
+	"github.com/nexgenomics/go-nexgenomics/nexgenomicstest"
+)
+
+func TestDedup(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "agent-1.dedup")
+	store, e := nexgenomics.NewFileDedup(path, 100)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	h := nexgenomics.NewWebhook("abc", append(srv.WebhookOptions(), nexgenomics.WithDedup(store))...)
+	if e := h.SendSentences("one", "two", "one"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := h.SendSentences("two", "three"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	store.Close()
+
+	if got := srv.Sentences(); len(got) != 3 || got[2] != "three" {
+		t.Errorf("unexpected sentences %q", got)
+	}
+	if n := h.DuplicatesSkipped(); n != 2 {
+		t.Errorf("expected 2 skipped, got %d", n)
+	}
+
+	// The store survives a restart.
+	store, e = nexgenomics.NewFileDedup(path, 100)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	defer store.Close()
+	h = nexgenomics.NewWebhook("abc", append(srv.WebhookOptions(), nexgenomics.WithDedup(store))...)
+	h.SendSentences("one", "four")
+	if got := srv.Sentences(); len(got) != 4 || got[3] != "four" || h.DuplicatesSkipped() != 1 {
+		t.Errorf("after reopening: sentences %q, skipped %d", got, h.DuplicatesSkipped())
+	}
+}
+
+func TestDedupSentenceWriter(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+
+	h := nexgenomics.NewWebhook("abc", append(srv.WebhookOptions(), nexgenomics.WithDedup(nexgenomics.NewMemoryDedup(100)))...)
+	sw := h.NewSentenceWriter(context.Background(), nexgenomics.WithFlushInterval(0))
+	sw.Add("same")
+	sw.Add("same")
+	if e := sw.Close(); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if got := srv.Sentences(); len(got) != 1 || h.DuplicatesSkipped() != 1 {
+		t.Errorf("sentences %q, skipped %d", got, h.DuplicatesSkipped())
+	}
+}
+
+func TestDedupSkipsCountedWhenSent(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+
+	store := nexgenomics.NewMemoryDedup(100)
+	h := nexgenomics.NewWebhook("abc", append(srv.WebhookOptions(),
+		nexgenomics.WithDedup(store), nexgenomics.WithMaxChunkSize(10))...)
+	e := h.SendSentences("one", "one", strings.Repeat("x", 20))
+	if !errors.Is(e, nexgenomics.ErrSentenceTooLarge) {
+		t.Fatalf("expected ErrSentenceTooLarge, got %v", e)
+	}
+	if n := h.DuplicatesSkipped(); n != 0 {
+		t.Errorf("expected nothing skipped by a failed call, got %d", n)
+	}
+}
+
+func TestDedupSplitSentence(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+
+	store := nexgenomics.NewMemoryDedup(100)
+	opts := append(srv.WebhookOptions(),
+		nexgenomics.WithDedup(store),
+		nexgenomics.WithMaxChunkSize(12),
+		nexgenomics.WithOversizePolicy(nexgenomics.OversizeSplit),
+		nexgenomics.WithConcurrency(2))
+	h := nexgenomics.NewWebhook("abc", opts...)
+
+	// one of the two pieces fails, whichever is sent first, so the
+	// sentence must not be recorded as sent.
+	long := "first half. second half."
+	srv.Fail(nexgenomicstest.Failure{Path: "/wh/sentences", Status: http.StatusBadRequest})
+	if e := h.SendSentences(long); e == nil {
+		t.Fatalf("expected an error")
+	}
+	if e := h.SendSentences(long); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if h.DuplicatesSkipped() != 0 {
+		t.Errorf("a partly sent sentence was skipped on resend")
+	}
+
+	// once every piece is accepted it is a duplicate.
+	if e := h.SendSentences(long); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if h.DuplicatesSkipped() != 1 {
+		t.Errorf("expected the sent sentence to be skipped, got %d", h.DuplicatesSkipped())
+	}
+}
+
+func TestMemoryDedupEviction(t *testing.T) {
+	m := nexgenomics.NewMemoryDedup(2)
+	a, b, c := [32]byte{1}, [32]byte{2}, [32]byte{3}
+	m.Add(a)
+	m.Add(b)
+	m.Contains(a)
+	m.Add(c)
+	if !m.Contains(a) || m.Contains(b) || !m.Contains(c) {
+		t.Errorf("expected the least recently used hash to be evicted")
+	}
+}
+
+func TestFileDedupWriteFailure(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+
+	// A directory in the way of the compacted file makes compaction fail.
+	path := filepath.Join(t.TempDir(), "agent-1.dedup")
+	if e := os.Mkdir(path+".tmp", 0o755); e != nil {
+		t.Fatalf("%s", e)
+	}
+	store, e := nexgenomics.NewFileDedup(path, 1)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	var logged bytes.Buffer
+	opts := append(srv.WebhookOptions(),
+		nexgenomics.WithDedup(store),
+		nexgenomics.WithLogger(slog.New(slog.NewTextHandler(&logged, nil))))
+	h := nexgenomics.NewWebhook("abc", opts...)
+
+	// The chunk is delivered, so the upload still succeeds.
+	if e := h.SendSentences("one", "two"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if !strings.Contains(logged.String(), "dedup store failed") {
+		t.Errorf("expected the failure to be logged, got %q", logged.String())
+	}
+	if e := store.Add([32]byte{9}); e == nil {
+		t.Errorf("expected later adds to report the failure")
+	}
+	if e := store.Close(); e == nil {
+		t.Errorf("expected Close to report the failure")
+	}
+}
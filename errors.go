@@ -0,0 +1,127 @@
+package nexgenomics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Sentinel errors for the common failure classes. Errors returned by the
+// Webhook and the Agentstore match them with errors.Is.
+var (
+	ErrUnauthorized = errors.New("unauthorized") // 401 or 403
+	ErrNotFound     = errors.New("not found")    // 404
+)
+
+// APIError is returned when a NexGenomics service answers with an
+// unsuccessful HTTP status.
+type APIError struct {
+	StatusCode int
+	RequestID  string // from the X-Request-Id response header, if present
+	Message    string // the server's explanation, if it gave one
+	Body       string
+	Header     http.Header
+}
+
+// Error
+func (e *APIError) Error() string {
+	var s string
+	switch e.StatusCode {
+	case 401, 403:
+		s = "unauthorized"
+	default:
+		s = fmt.Sprintf("failed with status %d", e.StatusCode)
+	}
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		s += fmt.Sprintf(" (request %s)", e.RequestID)
+	}
+	return s
+}
+
+// Is matches the sentinel errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == 401 || e.StatusCode == 403
+	case ErrNotFound:
+		return e.StatusCode == 404
+	}
+	return false
+}
+
+// RateLimitError is returned for 429 responses. RetryAfter is how long the
+// server asked us to wait, or zero if it did not say.
+type RateLimitError struct {
+	*APIError
+	RetryAfter time.Duration
+}
+
+// Error
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited, retry after %v: %v", e.RetryAfter, e.APIError)
+	}
+	return fmt.Sprintf("rate limited: %v", e.APIError)
+}
+
+// Unwrap
+func (e *RateLimitError) Unwrap() error {
+	return e.APIError
+}
+
+// check_response returns nil for a successful response, and otherwise the
+// typed error that describes it.
+func check_response(resp *resty.Response) error {
+	sc := resp.StatusCode()
+	if sc >= 200 && sc < 300 {
+		return nil
+	}
+
+	ae := &APIError{
+		StatusCode: sc,
+		RequestID:  resp.Header().Get("X-Request-Id"),
+		Body:       resp.String(),
+		Header:     resp.Header(),
+	}
+	ae.Message = error_message(resp.Body())
+
+	if sc == 429 {
+		return &RateLimitError{
+			APIError:   ae,
+			RetryAfter: parse_retry_after(ae.Header.Get("Retry-After")),
+		}
+	}
+	return ae
+}
+
+// error_message extracts the server's message from an error body, which is
+// either a JSON object with an "error" or "message" field, or plain text.
+func error_message(body []byte) string {
+	var m struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &m) == nil {
+		if m.Message != "" {
+			return m.Message
+		}
+		if m.Error != "" {
+			return m.Error
+		}
+		return ""
+	}
+
+	s := strings.TrimSpace(string(body))
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package nexgenomics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+func TestErrors(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Header().Set("Retry-After", "7")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":"nope"}`))
+	}))
+	defer srv.Close()
+
+	h := nexgenomics.NewWebhook("abc", nexgenomics.WithBaseURL(srv.URL))
+
+	for _, status = range []int{401, 403, 404, 429, 500} {
+		e := h.SendSentences("one")
+
+		var ae *nexgenomics.APIError
+		if !errors.As(e, &ae) {
+			t.Fatalf("%d: expected an APIError, got %v", status, e)
+		}
+		if ae.StatusCode != status || ae.RequestID != "req-1" || ae.Message != "nope" {
+			t.Errorf("%d: unexpected APIError %+v", status, ae)
+		}
+		if got := errors.Is(e, nexgenomics.ErrUnauthorized); got != (status == 401 || status == 403) {
+			t.Errorf("%d: errors.Is(ErrUnauthorized) = %v", status, got)
+		}
+		if got := errors.Is(e, nexgenomics.ErrNotFound); got != (status == 404) {
+			t.Errorf("%d: errors.Is(ErrNotFound) = %v", status, got)
+		}
+
+		var rl *nexgenomics.RateLimitError
+		if got := errors.As(e, &rl); got != (status == 429) {
+			t.Errorf("%d: errors.As(RateLimitError) = %v", status, got)
+		} else if got && rl.RetryAfter != 7*time.Second {
+			t.Errorf("unexpected RetryAfter %v", rl.RetryAfter)
+		}
+	}
+}
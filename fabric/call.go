@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/nats-io/nats.go"
-	"log"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"strings"
+	"time"
 )
 
 // CallCfg
@@ -19,10 +21,13 @@ type CallCfg struct {
 	Endpoint string
 	Headers  []string
 	Body     any
+
+	TracerProvider trace.TracerProvider // optional; the global provider if nil
+	MeterProvider  metric.MeterProvider // optional; the global provider if nil
 }
 
 // Call
-func Call(cfg *CallCfg) (*Response, error) {
+func Call(cfg *CallCfg) (_ *Response, err error) {
 
 	// If the caller set a NATS endpoint in the call config, use that.
 	// Otherwise check the local system. This model gives the
@@ -38,11 +43,26 @@ func Call(cfg *CallCfg) (*Response, error) {
 		}
 	}
 
-	hdrs := cfg.Headers
-	if hdrs == nil {
-		hdrs = []string{}
+	// This implements the "modern" calling convention for agent-rest, where the method
+	// and endpoint are baked into the subject.
+	m := strings.TrimSpace(strings.ToLower(cfg.Method))
+	ep := strings.TrimSpace(strings.ToLower(cfg.Endpoint))
+	if ep[0] == '/' {
+		ep = ep[1:]
 	}
 
+	subj := fmt.Sprintf("agent.rest.%s.%s.%s.%s", cfg.Tenant, cfg.Agent, m, ep)
+
+	// The call is traced, and the trace context goes to the agent in the headers.
+	ctx, span := start_call(cfg.Ctx, cfg.TracerProvider, subj)
+	start := time.Now()
+	var sent, received int
+	defer func() {
+		end_call(ctx, cfg.MeterProvider, span, start, sent, received, err)
+	}()
+
+	hdrs := inject_headers(ctx, append([]string{}, cfg.Headers...))
+
 	t2 := map[string]any{
 		"headers": hdrs,
 		"body":    cfg.Body,
@@ -51,6 +71,7 @@ func Call(cfg *CallCfg) (*Response, error) {
 	if e != nil {
 		return nil, e
 	}
+	sent = len(j)
 
 	nc, e := nats.Connect(natsurl)
 	if e != nil {
@@ -58,19 +79,11 @@ func Call(cfg *CallCfg) (*Response, error) {
 	}
 	defer nc.Drain()
 
-	// This implements the "modern" calling convention for agent-rest, where the method
-	// and endpoint are baked into the subject.
-	m := strings.TrimSpace(strings.ToLower(cfg.Method))
-	ep := strings.TrimSpace(strings.ToLower(cfg.Endpoint))
-	if ep[0] == '/' {
-		ep = ep[1:]
-	}
-
-	subj := fmt.Sprintf("agent.rest.%s.%s.%s.%s", cfg.Tenant, cfg.Agent, m, ep)
 	//log.Printf("Calling %v",subj)
 	//log.Printf("Calling %v",j)
 	msg, e := nc.RequestWithContext(cfg.Ctx, subj, j)
 	if e == nil {
+		received = len(msg.Data)
 		var r Response
 		json.Unmarshal(msg.Data, &r)
 		if r.Status == 200 {
@@ -87,7 +100,7 @@ func Call(cfg *CallCfg) (*Response, error) {
 // RawCall implements a blank nats call with no structure or interpretation
 // of the input and output. This is useful for certain system facilities (such
 // as the embedding engines) that use raw I/O.
-func RawCall(cfg *CallCfg) (*Response, error) {
+func RawCall(cfg *CallCfg) (_ *Response, err error) {
 
 	// If the caller set a NATS endpoint in the call config, use that.
 	// Otherwise check the local system. This model gives the
@@ -103,16 +116,26 @@ func RawCall(cfg *CallCfg) (*Response, error) {
 		}
 	}
 
+	subj := fmt.Sprintf("agent.rest.%s.%s", cfg.Tenant, cfg.Agent)
+	body := cfg.Body.([]byte)
+
+	// Raw messages have no headers, so the trace stops here.
+	ctx, span := start_call(cfg.Ctx, cfg.TracerProvider, subj)
+	start := time.Now()
+	var received int
+	defer func() {
+		end_call(ctx, cfg.MeterProvider, span, start, len(body), received, err)
+	}()
+
 	nc, e := nats.Connect(natsurl)
 	if e != nil {
 		return nil, e
 	}
 	defer nc.Drain()
 
-	subj := fmt.Sprintf("agent.rest.%s.%s", cfg.Tenant, cfg.Agent)
-	log.Printf("--------- %v", subj)
-	msg, e := nc.RequestWithContext(cfg.Ctx, subj, cfg.Body.([]byte))
+	msg, e := nc.RequestWithContext(cfg.Ctx, subj, body)
 	if e == nil {
+		received = len(msg.Data)
 		var r Response
 		r.Body = msg.Data
 		return &r, nil
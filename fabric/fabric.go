@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/trace"
 	"log"
 	"regexp"
 	"strings"
@@ -35,6 +36,17 @@ type Request struct {
 	Method   string
 	Endpoint string
 	Headers  map[string][]string
+
+	ctx context.Context
+}
+
+// Context returns the request's context, which carries the caller's trace
+// so that handlers can continue it.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
 }
 
 // Reply is used by clients of this library.
@@ -73,6 +85,7 @@ type Route struct {
 
 	subject_prefix string
 	subject_suffix string
+	tracer         trace.TracerProvider
 }
 
 // ServeCfg provides parameters that are optional (Verbose) or redundant with
@@ -84,6 +97,8 @@ type ServeCfg struct {
 	AgentId string
 	NatsUrl string
 	Verbose bool
+
+	TracerProvider trace.TracerProvider // optional; the global provider if nil
 }
 
 // Serve
@@ -119,6 +134,7 @@ func Serve(ctx context.Context, routes []Route, cfg *ServeCfg) (err error) {
 
 	// subscribe to routes
 	for _, r := range routes {
+		r.tracer = cfg.TracerProvider
 		if e := r.subscribe(nc, tenant, agentid); e == nil {
 		} else {
 			log.Printf("subscription error %v", e)
@@ -215,10 +231,15 @@ func (route *Route) handle_msg(msg *nats.Msg) {
 	// operation like an inference. Capture panics in case their code isn't
 	// cleanly written.
 	// Remember that we convert a Reply from the client into a Response here.
+	var span trace.Span
+	req.ctx, span = start_serve(extract_headers(req.Headers), route.tracer, msg.Subject)
+
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
-				send_error(fmt.Errorf("%v", r), 500)
+				e := fmt.Errorf("%v", r)
+				end_serve(span, 500, e)
+				send_error(e, 500)
 			}
 		}()
 
@@ -227,6 +248,7 @@ func (route *Route) handle_msg(msg *nats.Msg) {
 
 		// convert the reply from the user code into a Response.
 		resp := reply.to_response()
+		end_serve(span, resp.Status, reply.Error)
 		// ALWAYS send a response, even if the Body is nil
 		resp.respond(msg)
 
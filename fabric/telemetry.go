@@ -0,0 +1,146 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Calls and served requests are traced and measured through the providers
+// in CallCfg and ServeCfg, or else the global OpenTelemetry providers, which
+// do nothing until the program installs real ones with
+// otel.SetTracerProvider and otel.SetMeterProvider.
+// The trace context travels in the headers array as "traceparent:..." and
+// "tracestate:..." entries.
+//
+// The metrics share their names with the HTTP clients and are told apart
+// by the nexgenomics.service attribute, which is "fabric":
+//
+//	nexgenomics.client.request.duration  histogram of call latency, in seconds
+//	nexgenomics.client.request.size      counter of request bytes sent
+//	nexgenomics.client.response.size     counter of response bytes received
+//	nexgenomics.client.errors            counter of failed calls
+
+const instrumentation_name = "github.com/nexgenomics/go-nexgenomics/fabric"
+
+// tracer returns the tracer from tp, or from the global provider if tp is nil.
+func tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(instrumentation_name)
+}
+
+// start_call opens the span for a call to subj.
+func start_call(ctx context.Context, tp trace.TracerProvider, subj string) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer(tp).Start(ctx, "fabric call "+subj,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("nexgenomics.service", "fabric"),
+			attribute.String("messaging.system", "nats"),
+			attribute.String("messaging.destination.name", subj)))
+}
+
+// start_serve opens the span for a request being handled, continuing the
+// trace in ctx.
+func start_serve(ctx context.Context, tp trace.TracerProvider, subj string) (context.Context, trace.Span) {
+	return tracer(tp).Start(ctx, "fabric serve "+subj,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("nexgenomics.service", "fabric"),
+			attribute.String("messaging.system", "nats"),
+			attribute.String("messaging.destination.name", subj)))
+}
+
+// end_serve records the status of a handled request and ends its span.
+func end_serve(span trace.Span, status int, e error) {
+	span.SetAttributes(attribute.Int("nexgenomics.status", status))
+	if status != 200 {
+		if e != nil {
+			span.RecordError(e)
+		}
+		span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+	}
+	span.End()
+}
+
+// instruments are the metrics recorded for calls.
+type instruments struct {
+	duration metric.Float64Histogram
+	sent     metric.Int64Counter
+	received metric.Int64Counter
+	errors   metric.Int64Counter
+}
+
+// global_instruments are created once from the global meter provider,
+// which forwards them to any provider installed later.
+var global_instruments = sync.OnceValue(func() *instruments {
+	return new_instruments(otel.GetMeterProvider())
+})
+
+// new_instruments
+func new_instruments(mp metric.MeterProvider) *instruments {
+	i := &instruments{}
+	m := mp.Meter(instrumentation_name)
+	i.duration, _ = m.Float64Histogram("nexgenomics.client.request.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of each request attempt."))
+	i.sent, _ = m.Int64Counter("nexgenomics.client.request.size",
+		metric.WithUnit("By"), metric.WithDescription("Request body bytes sent."))
+	i.received, _ = m.Int64Counter("nexgenomics.client.response.size",
+		metric.WithUnit("By"), metric.WithDescription("Response body bytes received."))
+	i.errors, _ = m.Int64Counter("nexgenomics.client.errors",
+		metric.WithUnit("{error}"), metric.WithDescription("Request attempts that failed."))
+	return i
+}
+
+// end_call records the outcome and metrics of a call through mp, or the
+// global provider if mp is nil, and ends its span.
+func end_call(ctx context.Context, mp metric.MeterProvider, span trace.Span, start time.Time, sent int, received int, e error) {
+	i := global_instruments()
+	if mp != nil {
+		i = new_instruments(mp)
+	}
+	set := metric.WithAttributes(attribute.String("nexgenomics.service", "fabric"))
+
+	i.duration.Record(ctx, time.Since(start).Seconds(), set)
+	i.sent.Add(ctx, int64(sent), set)
+	i.received.Add(ctx, int64(received), set)
+	if e != nil {
+		i.errors.Add(ctx, 1, set)
+		span.RecordError(e)
+		span.SetStatus(codes.Error, e.Error())
+	}
+	span.End()
+}
+
+// inject_headers appends the trace context of ctx to hdrs.
+func inject_headers(ctx context.Context, hdrs []string) []string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	for _, k := range carrier.Keys() {
+		hdrs = append(hdrs, k+":"+carrier.Get(k))
+	}
+	return hdrs
+}
+
+// extract_headers returns a context carrying the trace context found in
+// headers parsed by parseHeaders.
+func extract_headers(headers map[string][]string) context.Context {
+	carrier := propagation.MapCarrier{}
+	for k, v := range headers {
+		carrier.Set(k, strings.Join(v, ","))
+	}
+	return propagation.TraceContext{}.Extract(context.Background(), carrier)
+}
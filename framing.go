@@ -0,0 +1,100 @@
+package nexgenomics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+)
+
+// Framing selects how sentences are delimited in an upload body.
+type Framing int
+
+const (
+	// FramingNewline joins sentences with "\n". This is the legacy format
+	// and the default; a sentence that contains a newline arrives at the
+	// server as several sentences.
+	FramingNewline Framing = iota
+
+	// FramingLengthPrefixed precedes each sentence with its length as a
+	// 4-byte big-endian integer. Sentences may contain any bytes at all,
+	// so this is the format to use for binary payloads.
+	FramingLengthPrefixed
+
+	// FramingJSONLines encodes each sentence as a JSON string on its own
+	// line. Text must be valid UTF-8; invalid bytes are replaced by U+FFFD.
+	FramingJSONLines
+)
+
+// Content types for each framing.
+const (
+	ContentTypeNewline        = "application/octet-stream"
+	ContentTypeLengthPrefixed = "application/vnd.nexgenomics.sentences.lp"
+	ContentTypeJSONLines      = "application/jsonl"
+)
+
+// WithFraming sets the wire format used for sentence uploads.
+func WithFraming(f Framing) WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.framing = f
+	})
+}
+
+// String
+func (f Framing) String() string {
+	switch f {
+	case FramingNewline:
+		return "newline"
+	case FramingLengthPrefixed:
+		return "length-prefixed"
+	case FramingJSONLines:
+		return "jsonl"
+	default:
+		return "unknown"
+	}
+}
+
+// content_type
+func (f Framing) content_type() string {
+	switch f {
+	case FramingLengthPrefixed:
+		return ContentTypeLengthPrefixed
+	case FramingJSONLines:
+		return ContentTypeJSONLines
+	default:
+		return ContentTypeNewline
+	}
+}
+
+// encode frames a single sentence.
+func (f Framing) encode(s string) ([]byte, error) {
+	switch f {
+	case FramingLengthPrefixed:
+		b := make([]byte, 4, 4+len(s))
+		binary.BigEndian.PutUint32(b, uint32(len(s)))
+		return append(b, s...), nil
+	case FramingJSONLines:
+		return encode_json_line(s)
+	default:
+		return []byte(s), nil
+	}
+}
+
+// separator is placed between framed sentences.
+func (f Framing) separator() []byte {
+	if f == FramingNewline {
+		return []byte("\n")
+	}
+	return nil
+}
+
+// encode_json_line marshals v followed by a newline, without escaping HTML
+// characters, which would only inflate the body.
+func encode_json_line(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if e := enc.Encode(v); e != nil {
+		return nil, e
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,103 @@
+package nexgenomics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// DefaultPollInterval is how often WaitForState checks an agent unless
+// changed with WithPollInterval.
+const DefaultPollInterval = 2 * time.Second
+
+// ErrAgentFailed is returned by WaitForState when the agent fails before
+// reaching the state being waited for.
+var ErrAgentFailed = errors.New("agent failed")
+
+// Artifact is a build of an agent to deploy.
+type Artifact struct {
+	Image   string `json:"image"`             // container image reference
+	Version string `json:"version,omitempty"` // recorded as the agent's runtime version
+	Digest  string `json:"digest,omitempty"`  // pins the image, if set
+}
+
+// agentstore_option is an AgentstoreOption that only makes sense for an
+// Agentstore.
+type agentstore_option func(*Agentstore)
+
+func (o agentstore_option) apply_agentstore(as *Agentstore) { o(as) }
+
+// WithPollInterval sets how often WaitForState checks an agent.
+func WithPollInterval(d time.Duration) AgentstoreOption {
+	return agentstore_option(func(as *Agentstore) {
+		as.poll = d
+	})
+}
+
+// StartAgent asks for an agent to be started and returns it as it is now,
+// usually AgentStarting. Use WaitForState to wait until it is running.
+func (as *Agentstore) StartAgent(ctx context.Context, id string) (*Agent, error) {
+	return as.lifecycle(ctx, id, "start", nil)
+}
+
+// StopAgent asks for an agent to be stopped.
+func (as *Agentstore) StopAgent(ctx context.Context, id string) (*Agent, error) {
+	return as.lifecycle(ctx, id, "stop", nil)
+}
+
+// RestartAgent asks for an agent to be stopped and started again.
+func (as *Agentstore) RestartAgent(ctx context.Context, id string) (*Agent, error) {
+	return as.lifecycle(ctx, id, "restart", nil)
+}
+
+// DeployAgent rolls an agent out to a new artifact. The agent goes through
+// AgentDeploying and is started again if it was running.
+func (as *Agentstore) DeployAgent(ctx context.Context, id string, artifact Artifact) (*Agent, error) {
+	return as.lifecycle(ctx, id, "deploy", artifact)
+}
+
+// lifecycle
+func (as *Agentstore) lifecycle(ctx context.Context, id string, action string, body any) (*Agent, error) {
+	var a Agent
+	if e := as.call(ctx, resty.MethodPost, agent_path(id)+"/"+action, body, &a); e != nil {
+		return nil, e
+	}
+	return &a, nil
+}
+
+// WaitForState polls an agent until its status is state, and returns it.
+// It gives up with ErrAgentFailed if the agent fails first, or with the
+// context's error when ctx is done. On error it returns the agent as last
+// seen, if it was seen at all.
+func (as *Agentstore) WaitForState(ctx context.Context, id string, state AgentStatus) (*Agent, error) {
+	interval := as.poll
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var last *Agent
+	for {
+		a, e := as.GetAgent(ctx, id)
+		if e != nil {
+			return last, e
+		}
+		last = a
+		if a.Status == state {
+			return a, nil
+		}
+		if a.Status == AgentFailed {
+			return a, fmt.Errorf("waiting for %s to be %s: %w", id, state, ErrAgentFailed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return a, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package nexgenomics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+	"github.com/nexgenomics/go-nexgenomics/nexgenomicstest"
+)
+
+func TestAgentLifecycle(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	opts := append(srv.AgentstoreOptions(), nexgenomics.WithPollInterval(time.Millisecond))
+	as := nexgenomics.NewAgentstore("agentstore-token", opts...)
+	ctx := context.Background()
+
+	a, e := as.CreateAgent(ctx, nexgenomics.CreateAgentRequest{Name: "ingest"})
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	if s, e := as.StartAgent(ctx, a.Id); e != nil || s.Status != nexgenomics.AgentStarting {
+		t.Fatalf("start: %+v, %v", s, e)
+	}
+	if r, e := as.WaitForState(ctx, a.Id, nexgenomics.AgentRunning); e != nil || r.Status != nexgenomics.AgentRunning {
+		t.Fatalf("wait: %+v, %v", r, e)
+	}
+
+	d, e := as.DeployAgent(ctx, a.Id, nexgenomics.Artifact{Image: "registry.example/ingest:2", Version: "2"})
+	if e != nil || d.Status != nexgenomics.AgentDeploying || d.Runtime.Version != "2" {
+		t.Fatalf("deploy: %+v, %v", d, e)
+	}
+	if _, e := as.WaitForState(ctx, a.Id, nexgenomics.AgentRunning); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	if _, e := as.RestartAgent(ctx, a.Id); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if _, e := as.WaitForState(ctx, a.Id, nexgenomics.AgentRunning); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	if _, e := as.StopAgent(ctx, a.Id); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if _, e := as.WaitForState(ctx, a.Id, nexgenomics.AgentStopped); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	var api *nexgenomics.APIError
+	if _, e := as.DeployAgent(ctx, a.Id, nexgenomics.Artifact{}); !errors.As(e, &api) || api.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a 400 for a deploy without an image, got %v", e)
+	}
+
+	// a stopped agent never starts by itself, so the wait times out.
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if w, e := as.WaitForState(tctx, a.Id, nexgenomics.AgentRunning); !errors.Is(e, context.DeadlineExceeded) || w == nil || w.Status != nexgenomics.AgentStopped {
+		t.Errorf("expected a timeout with the stopped agent, got %+v, %v", w, e)
+	}
+
+	srv.SetAgents(nexgenomics.Agent{Id: "broken", Name: "broken", Status: nexgenomics.AgentFailed})
+	if _, e := as.WaitForState(ctx, "broken", nexgenomics.AgentRunning); !errors.Is(e, nexgenomics.ErrAgentFailed) {
+		t.Errorf("expected ErrAgentFailed, got %v", e)
+	}
+}
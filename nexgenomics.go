@@ -1,16 +1,52 @@
 package nexgenomics
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/go-resty/resty/v2"
 )
 
+// DefaultWebhookURL is the base URL of the NexGenomics webhook service.
+const DefaultWebhookURL = "https://webhook.nexgenomics.ai"
+
 // Webhook accesses agents in the NexGenomics cloud using a webhook interface.
 // The object requires an authorization token belonging to the agent you want to access.
 type Webhook struct {
 	Token string
+
+	conn
+	framing     Framing
+	compression Compression
+	concurrency int
+	ordered     bool
+	maxchunk    int
+	oversize    OversizePolicy
+	redactors   []Redactor
+	audit       func(RedactionReport)
+	dedup       DedupStore
+	skipped     atomic.Int64
+}
+
+// WithConcurrency lets the Webhook upload up to n chunks at a time.
+// The default is one.
+func WithConcurrency(n int) WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.concurrency = n
+	})
+}
+
+// WithOrdered makes the Webhook commit chunks strictly in order: chunk k+1
+// is only sent after chunk k has been accepted. Combined with
+// WithConcurrency, the next chunks are still encoded and compressed while
+// the current one is uploading.
+func WithOrdered() WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.ordered = true
+	})
 }
 
 // Ping is a trivial package test.
@@ -21,60 +57,161 @@ func Ping(s string) string {
 // NewWebhook returns a Webhook object.
 // Webhooks are always directed to a specific NexGenomics Agent, hence they require
 // an authorization token which is generated for that agent.
-func NewWebhook(token string) *Webhook {
-	return &Webhook{
+func NewWebhook(token string, opts ...WebhookOption) *Webhook {
+	wh := &Webhook{
 		Token: token,
+		conn:  new_conn("webhook", DefaultWebhookURL),
 	}
+	for _, o := range opts {
+		o.apply_webhook(wh)
+	}
+	wh.finish()
+	return wh
 }
 
 // SendSentences sends an array of sentences to the NexGenomics cloud.
+// It is equivalent to SendSentencesContext with a background context.
 func (wh *Webhook) SendSentences(sentences ...string) error {
+	return wh.SendSentencesContext(context.Background(), sentences...)
+}
 
-	send_blob := func(blob []string) error {
-		blob_bytes := []byte(strings.Join(blob, "\n"))
-		c := resty.New()
-		resp, e := c.R().
-			SetHeader("Content-Type", "application/octet-stream").
-			SetHeader("Authorization", fmt.Sprintf("Bearer %s", wh.Token)).
-			SetBody(blob_bytes).
-			Post("https://webhook.nexgenomics.ai/wh/sentences")
-
-		if e != nil {
-			return e
-		}
-		if sc := resp.StatusCode(); sc == 403 {
-			return fmt.Errorf("unauthorized")
-		} else if sc != 200 {
-			return fmt.Errorf("failed with status %d", sc)
-		}
-
-		return nil
+// SendSentencesContext sends an array of sentences to the NexGenomics cloud.
+// The context applies to every chunk, so cancelling it stops the upload
+// before the next chunk is sent.
+// If a chunk fails, the returned error is a *SendError that reports which
+// sentences were accepted. A sentence too large for a chunk is handled by
+// the oversize policy before anything is sent.
+func (wh *Webhook) SendSentencesContext(ctx context.Context, sentences ...string) error {
+	b, e := wh.sentence_batch(sentences, nil)
+	if e != nil {
+		return e
 	}
+	return wh.send_records(ctx, b)
+}
 
-	// Chunk the incoming sentences to fit appropriate message size limits
-	maxbloblen := 500_000
-	bloblen := 0
-	blobslice := []string{}
+// send_records sends encoded records in chunks that fit the message size
+// limit. Chunks are prepared on one goroutine and uploaded by up to
+// wh.concurrency others. After the first failure no further chunks are
+// started, but uploads already in flight are allowed to finish. Every chunk
+// that was prepared is in the report, so Resume never skips a sentence
+// however the uploads interleave.
+func (wh *Webhook) send_records(ctx context.Context, b *batch) error {
+	type queued struct {
+		index int
+		chunk
+	}
+	type result struct {
+		index int
+		chunk SentenceRange // records in the chunk
+		r     SentenceRange // caller's sentences in the chunk
+		err   error
+	}
 
-	for _, j := range sentences {
-		bloblen += len(j)
-		blobslice = append(blobslice, j)
+	wh.skipped.Add(int64(b.skipped))
 
-		if bloblen >= maxbloblen {
-			if e := send_blob(blobslice); e != nil {
-				return e
-			}
+	ahead := max(wh.concurrency, 1)
+	workers := ahead
+	if wh.ordered {
+		workers = 1
+	}
 
-			blobslice = []string{}
-			bloblen = 0
+	var (
+		stop    atomic.Bool
+		mu      sync.Mutex
+		results []result
+	)
+	save := func(res result) {
+		mu.Lock()
+		results = append(results, res)
+		mu.Unlock()
+		if res.err != nil {
+			stop.Store(true)
 		}
 	}
 
-	if bloblen > 0 {
-		if e := send_blob(blobslice); e != nil {
-			return e
+	queue := make(chan queued, ahead)
+	go func() {
+		defer close(queue)
+		c := wh.new_chunker(b)
+		for i := 0; !stop.Load(); i++ {
+			ch, ok, e := c.next()
+			if e != nil {
+				rest := SentenceRange{Start: c.pos, End: len(b.records)}
+				save(result{index: i, chunk: rest, r: b.map_range(rest), err: e})
+				return
+			}
+			if !ok {
+				return
+			}
+			wh.report_redactions(b, ch)
+			queue <- queued{index: i, chunk: ch}
 		}
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range queue {
+				r := b.map_range(q.SentenceRange)
+				if stop.Load() {
+					save(result{index: q.index, chunk: q.SentenceRange, r: r, err: ErrNotSent})
+					continue
+				}
+				cctx, span := wh.start_chunk(ctx, q.index, r, len(q.body))
+				e := wh.send_blob(cctx, b.content_type, q.body)
+				end_span(span, e)
+				save(result{index: q.index, chunk: q.SentenceRange, r: r, err: e})
+			}
+		}()
 	}
+	wg.Wait()
 
+	sort.Slice(results, func(i, j int) bool { return results[i].index < results[j].index })
+
+	var report SendError
+	accepted := []SentenceRange{}
+	for _, res := range results {
+		if res.err != nil {
+			report.fail(res.r, res.err)
+		} else {
+			report.Accepted = append(report.Accepted, res.r)
+			accepted = append(accepted, res.chunk)
+		}
+	}
+	wh.mark_sent(b, accepted)
+	if len(report.Failed) > 0 {
+		return &report
+	}
 	return nil
 }
+
+// send_blob posts a single chunk, retrying according to the Webhook's
+// policy. Every attempt carries the same idempotency key so the server can
+// drop a chunk it has already accepted.
+func (wh *Webhook) send_blob(ctx context.Context, content_type string, body []byte) error {
+	return wh.post(ctx, content_type, wh.compression.content_encoding(), body, new_idempotency_key())
+}
+
+// post uploads a chunk that has already been encoded.
+func (wh *Webhook) post(ctx context.Context, content_type string, content_encoding string, body []byte, key string) error {
+	_, e := wh.execute(ctx, wh.token_source(wh.Token), resty.MethodPost, wh.url(), func(req *resty.Request) {
+		req.SetHeader("Content-Type", content_type).
+			SetHeader("Idempotency-Key", key).
+			SetBody(body)
+		if content_encoding != "" {
+			req.SetHeader("Content-Encoding", content_encoding)
+		}
+	})
+	return e
+}
+
+// url returns the sentence upload endpoint.
+func (wh *Webhook) url() string {
+	base := wh.baseurl
+	if base == "" {
+		base = DefaultWebhookURL
+	}
+	return base + "/wh/sentences"
+}
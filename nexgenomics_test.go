@@ -1,28 +1,32 @@
 package nexgenomics_test
 
 import (
-	"os"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/nexgenomics/go-nexgenomics"
+	"github.com/nexgenomics/go-nexgenomics/nexgenomicstest"
 )
 
-var (
-	WEBHOOK_TOKEN string
-)
-
-func init() {
-	WEBHOOK_TOKEN = os.Getenv("WEBHOOK_TOKEN")
-}
-
 func TestPing(t *testing.T) {
 	t.Logf("%s", nexgenomics.Ping("abc"))
 }
 
 func TestNewWebhook(t *testing.T) {
-	t.Logf("webhook token [%s]", WEBHOOK_TOKEN)
-	h := nexgenomics.NewWebhook(WEBHOOK_TOKEN)
-	//t.Logf("%s", h)
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	srv.AllowTokens("webhook-token")
+
+	h := nexgenomics.NewWebhook("webhook-token", srv.WebhookOptions()...)
 
 	sentences := []string{
 		"This is thing 1",
@@ -35,4 +39,286 @@ func TestNewWebhook(t *testing.T) {
 	if e != nil {
 		t.Errorf("%s", e)
 	}
+	if got := srv.Sentences(); strings.Join(got, "|") != strings.Join(sentences, "|") {
+		t.Errorf("server received %q", got)
+	}
+}
+
+func TestWebhookOptions(t *testing.T) {
+	var path, ua, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		ua = r.Header.Get("User-Agent")
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	h := nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithHTTPClient(srv.Client()),
+		nexgenomics.WithTimeout(time.Second),
+		nexgenomics.WithUserAgent("test-agent"))
+
+	if e := h.SendSentencesContext(context.Background(), "one", "two"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if path != "/wh/sentences" || ua != "test-agent" || auth != "Bearer abc" {
+		t.Errorf("unexpected request path=%q ua=%q auth=%q", path, ua, auth)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if e := h.SendSentencesContext(ctx, "three"); !errors.Is(e, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", e)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	var calls int
+	keys := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		keys[r.Header.Get("Idempotency-Key")] = true
+		if calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	h := nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithRetry(nexgenomics.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     5 * time.Millisecond,
+		}))
+
+	if e := h.SendSentences("one"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if calls != 3 || len(keys) != 1 {
+		t.Errorf("expected 3 attempts with one idempotency key, got %d attempts and %d keys", calls, len(keys))
+	}
+}
+
+func TestSendError(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("bad chunk"))
+		}
+	}))
+	defer srv.Close()
+
+	big := strings.Repeat("x", 200_000)
+	sentences := []string{big, big, big, big, "tail"}
+
+	h := nexgenomics.NewWebhook("abc", nexgenomics.WithBaseURL(srv.URL))
+	e := h.SendSentences(sentences...)
+
+	var se *nexgenomics.SendError
+	if !errors.As(e, &se) {
+		t.Fatalf("expected a SendError, got %v", e)
+	}
+	if len(se.Accepted) != 1 || se.Accepted[0] != (nexgenomics.SentenceRange{Start: 0, End: 2}) {
+		t.Errorf("unexpected accepted ranges %v", se.Accepted)
+	}
+	if len(se.Failed) == 0 || se.Failed[0].Status != 400 || se.Failed[0].Body != "bad chunk" {
+		t.Fatalf("unexpected failures %v", se.Failed)
+	}
+	// a chunk prepared before the failure was seen is reported, not sent.
+	for _, f := range se.Failed[1:] {
+		if !errors.Is(f.Err, nexgenomics.ErrNotSent) {
+			t.Errorf("unexpected failure after the first %v", f)
+		}
+	}
+	if se.Resume() != 2 {
+		t.Errorf("expected to resume at 2, got %d", se.Resume())
+	}
+}
+
+func TestSendErrorReportsEveryChunk(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch string(body) {
+		case "s0":
+			// held until the failure of s1 has stopped the upload.
+			<-release
+		case "s1":
+			w.WriteHeader(http.StatusInternalServerError)
+			time.AfterFunc(50*time.Millisecond, func() { close(release) })
+		}
+	}))
+	defer srv.Close()
+
+	h := nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithMaxChunkSize(2),
+		nexgenomics.WithConcurrency(2))
+	e := h.SendSentences("s0", "s1", "s2", "s3", "s4", "s5")
+
+	var se *nexgenomics.SendError
+	if !errors.As(e, &se) {
+		t.Fatalf("expected a SendError, got %v", e)
+	}
+	if len(se.Accepted) != 1 || se.Accepted[0] != (nexgenomics.SentenceRange{Start: 0, End: 1}) {
+		t.Errorf("unexpected accepted ranges %v", se.Accepted)
+	}
+	if len(se.Failed) < 2 || se.Failed[0].Start != 1 || se.Failed[0].Status != http.StatusInternalServerError {
+		t.Fatalf("unexpected failures %v", se.Failed)
+	}
+	next := 1
+	for _, f := range se.Failed {
+		if f.Start != next {
+			t.Errorf("failures are not contiguous: %v", se.Failed)
+		}
+		next = f.End
+		if f.Start > 1 && !errors.Is(f.Err, nexgenomics.ErrNotSent) {
+			t.Errorf("expected ErrNotSent for %v", f)
+		}
+	}
+	if se.Resume() != 1 {
+		t.Errorf("expected to resume at 1, got %d", se.Resume())
+	}
+}
+
+func TestFraming(t *testing.T) {
+	var ctype string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctype = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	sentences := []string{"line one\nline two", "\x00\xff"}
+
+	h := nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithFraming(nexgenomics.FramingLengthPrefixed))
+	if e := h.SendSentences(sentences...); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if ctype != nexgenomics.ContentTypeLengthPrefixed {
+		t.Errorf("unexpected content type %q", ctype)
+	}
+	got := []string{}
+	for len(body) >= 4 {
+		n := binary.BigEndian.Uint32(body)
+		got = append(got, string(body[4:4+n]))
+		body = body[4+n:]
+	}
+	if len(got) != 2 || got[0] != sentences[0] || got[1] != sentences[1] {
+		t.Errorf("unexpected records %q", got)
+	}
+
+	h = nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithFraming(nexgenomics.FramingJSONLines))
+	if e := h.SendSentences(sentences[0]); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if ctype != nexgenomics.ContentTypeJSONLines || string(body) != `"line one\nline two"`+"\n" {
+		t.Errorf("unexpected jsonl body %q (%s)", body, ctype)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	var inflight, peak, calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		if calls.Add(1) == 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	big := strings.Repeat("x", 500_000)
+	sentences := []string{big, big, big, big, big, big, big, big}
+
+	h := nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithConcurrency(4))
+	var se *nexgenomics.SendError
+	if e := h.SendSentences(sentences...); !errors.As(e, &se) || len(se.Failed) == 0 {
+		t.Fatalf("expected a SendError, got %v", e)
+	}
+	// one chunk failed; any others were prepared but not sent.
+	sent := 0
+	for _, f := range se.Failed {
+		if !errors.Is(f.Err, nexgenomics.ErrNotSent) {
+			sent++
+		}
+	}
+	if sent != 1 || len(se.Accepted)+len(se.Failed) != len(sentences) {
+		t.Errorf("expected one failed chunk and every chunk reported, got %v", se)
+	}
+	if p := peak.Load(); p < 2 || p > 4 {
+		t.Errorf("expected between 2 and 4 concurrent uploads, got %d", p)
+	}
+
+	peak.Store(0)
+	calls.Store(0)
+	h = nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithConcurrency(4),
+		nexgenomics.WithOrdered())
+	e := h.SendSentences(sentences...)
+	if !errors.As(e, &se) {
+		t.Fatalf("expected a SendError, got %v", e)
+	}
+	if peak.Load() != 1 || calls.Load() != 3 || len(se.Accepted) != 2 || se.Resume() != 2 {
+		t.Errorf("ordered upload: peak %d, calls %d, accepted %v", peak.Load(), calls.Load(), se.Accepted)
+	}
+}
+
+func TestOversize(t *testing.T) {
+	bodies := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	long := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 4) + "Ünïcödé ünïcödé"
+
+	h := nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithMaxChunkSize(64))
+	if e := h.SendSentences("short", long); !errors.Is(e, nexgenomics.ErrSentenceTooLarge) {
+		t.Errorf("expected ErrSentenceTooLarge, got %v", e)
+	}
+	if len(bodies) != 0 {
+		t.Errorf("nothing should be sent when a sentence is rejected, got %q", bodies)
+	}
+
+	h = nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithMaxChunkSize(64),
+		nexgenomics.WithOversizePolicy(nexgenomics.OversizeSplit))
+	if e := h.SendSentences("short", long); e != nil {
+		t.Fatalf("%s", e)
+	}
+	joined := ""
+	for _, b := range bodies {
+		if len(b) > 64 || !utf8.ValidString(b) {
+			t.Errorf("bad body of %d bytes: %q", len(b), b)
+		}
+		joined += b
+	}
+	if strings.ReplaceAll(joined, "\n", "") != "short"+long {
+		t.Errorf("split pieces do not reassemble: %q", bodies)
+	}
 }
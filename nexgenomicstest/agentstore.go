@@ -0,0 +1,346 @@
+package nexgenomicstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+// Tenant is the tenant of the agents created through the Server.
+const Tenant = "nexgenomicstest"
+
+// serve_agentstore handles the agentstore API. It ASSUMES the lock is held.
+func (s *Server) serve_agentstore(r *http.Request, req *Request, respond func(int, any), fail func(int, string)) {
+	if r.URL.Path == "/api/agent-pages" {
+		if r.Method != http.MethodGet {
+			fail(http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		page, e := s.list_agents(r.URL.Query())
+		if e != nil {
+			fail(http.StatusBadRequest, e.Error())
+			return
+		}
+		respond(http.StatusOK, page)
+		return
+	}
+
+	if r.URL.Path == "/api/agents" {
+		switch r.Method {
+		case http.MethodGet:
+			respond(http.StatusOK, s.agents)
+		case http.MethodPost:
+			var c nexgenomics.CreateAgentRequest
+			if e := json.Unmarshal(req.Body, &c); e != nil {
+				fail(http.StatusBadRequest, e.Error())
+				return
+			}
+			if c.Name == "" {
+				fail(http.StatusBadRequest, "name is required")
+				return
+			}
+			s.nextid++
+			now := time.Now().UTC()
+			a := nexgenomics.Agent{
+				Id:        fmt.Sprintf("agent-%d", s.nextid),
+				Name:      c.Name,
+				Status:    nexgenomics.AgentStopped,
+				Tenant:    Tenant,
+				Tags:      c.Tags,
+				Labels:    c.Labels,
+				Model:     c.Model,
+				Runtime:   c.Runtime,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			s.agents = append(s.agents, a)
+			respond(http.StatusCreated, a)
+		default:
+			fail(http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/agents/")
+	parts := strings.Split(rest, "/")
+	if !ok || parts[0] == "" {
+		fail(http.StatusNotFound, "no such endpoint")
+		return
+	}
+	id := parts[0]
+	i := slices.IndexFunc(s.agents, func(a nexgenomics.Agent) bool { return a.Id == id })
+	if i < 0 {
+		fail(http.StatusNotFound, "no such agent")
+		return
+	}
+
+	if len(parts) > 1 && parts[1] == "tokens" {
+		s.serve_tokens(r, req, id, parts[2:], respond, fail)
+		return
+	}
+	if len(parts) == 2 && r.Method == http.MethodPost {
+		s.serve_lifecycle(req, i, parts[1], respond, fail)
+		return
+	}
+	if len(parts) > 1 {
+		fail(http.StatusNotFound, "no such endpoint")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respond(http.StatusOK, s.agents[i])
+		s.advance(id)
+	case http.MethodPatch:
+		var u nexgenomics.UpdateAgentRequest
+		if e := json.Unmarshal(req.Body, &u); e != nil {
+			fail(http.StatusBadRequest, e.Error())
+			return
+		}
+		a := &s.agents[i]
+		if u.Name != nil {
+			a.Name = *u.Name
+		}
+		if u.Tags != nil {
+			a.Tags = *u.Tags
+		}
+		for k, v := range u.Labels {
+			if a.Labels == nil {
+				a.Labels = map[string]string{}
+			}
+			if v == "" {
+				delete(a.Labels, k)
+			} else {
+				a.Labels[k] = v
+			}
+		}
+		if u.Model != nil {
+			a.Model = u.Model
+		}
+		if u.Runtime != nil {
+			a.Runtime = u.Runtime
+		}
+		a.UpdatedAt = time.Now().UTC()
+		respond(http.StatusOK, s.agents[i])
+	case http.MethodDelete:
+		s.agents = slices.Delete(s.agents, i, i+1)
+		delete(s.transitions, id)
+		for _, t := range s.agent_tokens[id] {
+			s.revoked[t.Token] = true
+		}
+		delete(s.agent_tokens, id)
+		respond(http.StatusNoContent, nil)
+	default:
+		fail(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// serve_lifecycle starts, stops, restarts or deploys the agent at index i.
+// The agent moves through its intermediate states one step each time it is
+// fetched, so WaitForState sees them. It ASSUMES the lock is held.
+func (s *Server) serve_lifecycle(req *Request, i int, action string, respond func(int, any), fail func(int, string)) {
+	a := &s.agents[i]
+	switch action {
+	case "start":
+		s.transition(a, nexgenomics.AgentStarting, nexgenomics.AgentRunning)
+	case "stop":
+		s.transition(a, nexgenomics.AgentStopping, nexgenomics.AgentStopped)
+	case "restart":
+		s.transition(a, nexgenomics.AgentStopping, nexgenomics.AgentStarting, nexgenomics.AgentRunning)
+	case "deploy":
+		var art nexgenomics.Artifact
+		if e := json.Unmarshal(req.Body, &art); e != nil {
+			fail(http.StatusBadRequest, e.Error())
+			return
+		}
+		if art.Image == "" {
+			fail(http.StatusBadRequest, "image is required")
+			return
+		}
+		if a.Runtime == nil {
+			a.Runtime = &nexgenomics.RuntimeConfig{}
+		} else {
+			rt := *a.Runtime
+			a.Runtime = &rt
+		}
+		a.Runtime.Image = art.Image
+		a.Runtime.Version = art.Version
+		if a.Status == nexgenomics.AgentRunning || a.Status == nexgenomics.AgentStarting {
+			s.transition(a, nexgenomics.AgentDeploying, nexgenomics.AgentStarting, nexgenomics.AgentRunning)
+		} else {
+			s.transition(a, nexgenomics.AgentDeploying, nexgenomics.AgentStopped)
+		}
+	default:
+		fail(http.StatusNotFound, "no such endpoint")
+		return
+	}
+	respond(http.StatusAccepted, *a)
+}
+
+// transition puts a into the first of states and queues the rest. It
+// ASSUMES the lock is held.
+func (s *Server) transition(a *nexgenomics.Agent, states ...nexgenomics.AgentStatus) {
+	a.Status = states[0]
+	a.UpdatedAt = time.Now().UTC()
+	s.transitions[a.Id] = states[1:]
+}
+
+// advance moves an agent to its next queued state. It ASSUMES the lock is
+// held.
+func (s *Server) advance(id string) {
+	next := s.transitions[id]
+	if len(next) == 0 {
+		return
+	}
+	i := slices.IndexFunc(s.agents, func(a nexgenomics.Agent) bool { return a.Id == id })
+	s.agents[i].Status = next[0]
+	s.agents[i].UpdatedAt = time.Now().UTC()
+	s.transitions[id] = next[1:]
+}
+
+// serve_tokens handles an agent's tokens. rest is the path after
+// /api/agents/{id}/tokens. It ASSUMES the lock is held.
+func (s *Server) serve_tokens(r *http.Request, req *Request, agent string, rest []string, respond func(int, any), fail func(int, string)) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		out := []nexgenomics.AgentToken{}
+		for _, t := range s.agent_tokens[agent] {
+			t.Token = ""
+			out = append(out, t)
+		}
+		respond(http.StatusOK, out)
+
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		var c struct {
+			Scopes     []string `json:"scopes"`
+			TTLSeconds int64    `json:"ttl_seconds"`
+		}
+		if e := json.Unmarshal(req.Body, &c); e != nil {
+			fail(http.StatusBadRequest, e.Error())
+			return
+		}
+		s.nextid++
+		t := nexgenomics.AgentToken{
+			Id:        fmt.Sprintf("tok-%d", s.nextid),
+			AgentId:   agent,
+			Token:     fmt.Sprintf("wh-%s-%d", agent, s.nextid),
+			Scopes:    c.Scopes,
+			CreatedAt: time.Now().UTC(),
+		}
+		if c.TTLSeconds > 0 {
+			t.ExpiresAt = t.CreatedAt.Add(time.Duration(c.TTLSeconds) * time.Second)
+		}
+		s.agent_tokens[agent] = append(s.agent_tokens[agent], t)
+		respond(http.StatusCreated, t)
+
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		j := slices.IndexFunc(s.agent_tokens[agent], func(t nexgenomics.AgentToken) bool { return t.Id == rest[0] })
+		if j < 0 {
+			fail(http.StatusNotFound, "no such token")
+			return
+		}
+		s.revoked[s.agent_tokens[agent][j].Token] = true
+		s.agent_tokens[agent] = slices.Delete(s.agent_tokens[agent], j, j+1)
+		respond(http.StatusNoContent, nil)
+
+	default:
+		fail(http.StatusNotFound, "no such endpoint")
+	}
+}
+
+// issued reports whether tok was created through the API and, if so,
+// whether it is still valid. It ASSUMES the lock is held.
+func (s *Server) issued(tok string) (valid bool, ok bool) {
+	if s.revoked[tok] {
+		return false, true
+	}
+	for _, tokens := range s.agent_tokens {
+		for _, t := range tokens {
+			if t.Token == tok {
+				return t.ExpiresAt.IsZero() || time.Now().Before(t.ExpiresAt), true
+			}
+		}
+	}
+	return false, false
+}
+
+// list_agents returns the page of agents selected by q. Cursors are offsets
+// into the filtered, sorted list. It ASSUMES the lock is held.
+func (s *Server) list_agents(q url.Values) (*nexgenomics.AgentPage, error) {
+	limit, e := strconv.Atoi(q.Get("limit"))
+	if e != nil || limit <= 0 {
+		return nil, fmt.Errorf("invalid limit %q", q.Get("limit"))
+	}
+	limit = min(limit, 1000)
+	offset := 0
+	if c := q.Get("cursor"); c != "" {
+		if offset, e = strconv.Atoi(c); e != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid cursor %q", c)
+		}
+	}
+	var after time.Time
+	if a := q.Get("created_after"); a != "" {
+		if after, e = time.Parse(time.RFC3339Nano, a); e != nil {
+			return nil, fmt.Errorf("invalid created_after %q", a)
+		}
+	}
+
+	agents := []nexgenomics.Agent{}
+	for _, a := range s.agents {
+		if !strings.HasPrefix(a.Name, q.Get("name_prefix")) {
+			continue
+		}
+		if !after.IsZero() && !a.CreatedAt.After(after) {
+			continue
+		}
+		if !has_tags(a.Tags, q["tag"]) {
+			continue
+		}
+		agents = append(agents, a)
+	}
+
+	sort := q.Get("sort")
+	desc := strings.HasPrefix(sort, "-")
+	var cmp func(a, b nexgenomics.Agent) int
+	switch strings.TrimPrefix(sort, "-") {
+	case "", "created_at":
+		cmp = func(a, b nexgenomics.Agent) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case "name":
+		cmp = func(a, b nexgenomics.Agent) int { return strings.Compare(a.Name, b.Name) }
+	default:
+		return nil, fmt.Errorf("invalid sort %q", sort)
+	}
+	slices.SortStableFunc(agents, func(a, b nexgenomics.Agent) int {
+		if desc {
+			return -cmp(a, b)
+		}
+		return cmp(a, b)
+	})
+
+	page := &nexgenomics.AgentPage{Agents: []nexgenomics.Agent{}}
+	if offset < len(agents) {
+		end := min(offset+limit, len(agents))
+		page.Agents = agents[offset:end]
+		if end < len(agents) {
+			page.NextCursor = strconv.Itoa(end)
+		}
+	}
+	return page, nil
+}
+
+// has_tags reports whether tags includes every one of want.
+func has_tags(tags []string, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(tags, w) {
+			return false
+		}
+	}
+	return true
+}
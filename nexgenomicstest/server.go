@@ -0,0 +1,351 @@
+// Package nexgenomicstest provides a fake NexGenomics cloud for tests.
+//
+// The Server implements the webhook sentence endpoint and the agentstore
+// API on an httptest server. Agents can be created, changed and deleted
+// through the API as well as set with SetAgents. It records every request, checks bearer
+// tokens, and can be scripted to fail, so code that uses the SDK can be
+// tested offline:
+//
+//	srv := nexgenomicstest.NewServer()
+//	defer srv.Close()
+//	srv.AllowTokens("agent-token")
+//
+//	wh := nexgenomics.NewWebhook("agent-token", srv.WebhookOptions()...)
+//	wh.SendSentences("hello")
+//	fmt.Println(srv.Sentences()) // [hello]
+package nexgenomicstest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+// Server is a fake NexGenomics cloud. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	tokens       map[string]bool
+	agents       []nexgenomics.Agent
+	nextid       int
+	agent_tokens map[string][]nexgenomics.AgentToken
+	revoked      map[string]bool
+	transitions  map[string][]nexgenomics.AgentStatus
+	requests     []Request
+	failures     []Failure
+	keys         map[string]bool
+}
+
+// Request is a request the Server received.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte // as received, before decompression
+
+	// For sentence uploads, the decoded contents. Sentences holds the text
+	// of structured records too.
+	Sentences []string
+	Records   []nexgenomics.Sentence
+
+	Status    int  // the status the Server answered with
+	Duplicate bool // an upload whose idempotency key had already been accepted
+}
+
+// Failure scripts an error response.
+type Failure struct {
+	Path    string // request path to match; empty matches every path
+	Status  int
+	Body    string
+	Headers map[string]string
+	Times   int // how many requests to fail; zero means one
+}
+
+// NewServer starts a Server. Until AllowTokens is called, any bearer token
+// is accepted.
+func NewServer() *Server {
+	s := &Server{
+		tokens:       map[string]bool{},
+		agent_tokens: map[string][]nexgenomics.AgentToken{},
+		revoked:      map[string]bool{},
+		transitions:  map[string][]nexgenomics.AgentStatus{},
+		keys:         map[string]bool{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// WebhookOptions returns the options that point a Webhook at the Server.
+func (s *Server) WebhookOptions() []nexgenomics.WebhookOption {
+	return []nexgenomics.WebhookOption{
+		nexgenomics.WithBaseURL(s.URL),
+		nexgenomics.WithHTTPClient(s.Client()),
+	}
+}
+
+// AgentstoreOptions returns the options that point an Agentstore at the Server.
+func (s *Server) AgentstoreOptions() []nexgenomics.AgentstoreOption {
+	return []nexgenomics.AgentstoreOption{
+		nexgenomics.WithBaseURL(s.URL),
+		nexgenomics.WithHTTPClient(s.Client()),
+	}
+}
+
+// ClientOptions returns the options that point a Client, and every
+// sub-client it returns, at the Server.
+func (s *Server) ClientOptions() []nexgenomics.ClientOption {
+	return []nexgenomics.ClientOption{
+		nexgenomics.WithEnvironment(nexgenomics.Environment{WebhookURL: s.URL, AgentstoreURL: s.URL}),
+		nexgenomics.WithHTTPClient(s.Client()),
+	}
+}
+
+// AllowTokens restricts the Server to the given bearer tokens. Other tokens
+// get a 401.
+func (s *Server) AllowTokens(tokens ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tokens {
+		s.tokens[t] = true
+	}
+}
+
+// RevokeTokens makes the Server refuse the given tokens.
+func (s *Server) RevokeTokens(tokens ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tokens {
+		s.tokens[t] = false
+	}
+}
+
+// SetAgents replaces the agents returned by the agentstore.
+func (s *Server) SetAgents(agents ...nexgenomics.Agent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.agents = append([]nexgenomics.Agent{}, agents...)
+	s.transitions = map[string][]nexgenomics.AgentStatus{}
+}
+
+// Fail queues a scripted failure. Failures are used in the order they were
+// queued, each by the first requests that match it.
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Times <= 0 {
+		f.Times = 1
+	}
+	s.failures = append(s.failures, f)
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Sentences returns the sentences from every accepted upload, in the order
+// they arrived, leaving out duplicate deliveries.
+func (s *Server) Sentences() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []string{}
+	for _, r := range s.requests {
+		if r.Status == http.StatusOK && !r.Duplicate {
+			out = append(out, r.Sentences...)
+		}
+	}
+	return out
+}
+
+// Reset forgets recorded requests, scripted failures and idempotency keys.
+// Tokens and agents are kept.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.failures = nil
+	s.keys = map[string]bool{}
+}
+
+// serve
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Header: r.Header.Clone(),
+		Body:   body,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.requests = append(s.requests, req) }()
+
+	respond := func(status int, v any) {
+		req.Status = status
+		w.Header().Set("X-Request-Id", fmt.Sprintf("req-%d", len(s.requests)+1))
+		if v == nil {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	fail := func(status int, msg string) {
+		respond(status, map[string]string{"error": msg})
+	}
+
+	if f := s.scripted(r.URL.Path); f != nil {
+		for k, v := range f.Headers {
+			w.Header().Set(k, v)
+		}
+		req.Status = f.Status
+		w.WriteHeader(f.Status)
+		io.WriteString(w, f.Body)
+		return
+	}
+
+	if !s.authorized(r) {
+		fail(http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/wh/sentences":
+		if e := decode_upload(&req); e != nil {
+			fail(http.StatusBadRequest, e.Error())
+			return
+		}
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			req.Duplicate = s.keys[key]
+			s.keys[key] = true
+		}
+		respond(http.StatusOK, nil)
+
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		s.serve_agentstore(r, &req, respond, fail)
+
+	default:
+		fail(http.StatusNotFound, "no such endpoint")
+	}
+}
+
+// scripted pops the first queued failure that matches path. It ASSUMES the
+// lock is held.
+func (s *Server) scripted(path string) *Failure {
+	for i := range s.failures {
+		f := &s.failures[i]
+		if f.Path != "" && f.Path != path {
+			continue
+		}
+		out := *f
+		f.Times--
+		if f.Times <= 0 {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+		}
+		return &out
+	}
+	return nil
+}
+
+// authorized checks the bearer token. Tokens created through the API are
+// valid until they expire or are revoked, whatever AllowTokens says. It
+// ASSUMES the lock is held.
+func (s *Server) authorized(r *http.Request) bool {
+	tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	if valid, ok := s.issued(tok); ok {
+		return valid
+	}
+	if len(s.tokens) == 0 {
+		return true
+	}
+	return s.tokens[tok]
+}
+
+// decode_upload decompresses and unframes a sentence upload.
+func decode_upload(req *Request) error {
+	raw := req.Body
+	switch req.Header.Get("Content-Encoding") {
+	case "":
+	case "gzip":
+		zr, e := gzip.NewReader(bytes.NewReader(raw))
+		if e != nil {
+			return e
+		}
+		if raw, e = io.ReadAll(zr); e != nil {
+			return e
+		}
+	case "zstd":
+		zr, e := zstd.NewReader(bytes.NewReader(raw))
+		if e != nil {
+			return e
+		}
+		defer zr.Close()
+		if raw, e = io.ReadAll(zr); e != nil {
+			return e
+		}
+	default:
+		return fmt.Errorf("unsupported content encoding %q", req.Header.Get("Content-Encoding"))
+	}
+
+	switch ct := req.Header.Get("Content-Type"); ct {
+	case nexgenomics.ContentTypeNewline:
+		req.Sentences = strings.Split(string(raw), "\n")
+
+	case nexgenomics.ContentTypeLengthPrefixed:
+		for len(raw) > 0 {
+			if len(raw) < 4 {
+				return fmt.Errorf("truncated length prefix")
+			}
+			n := binary.BigEndian.Uint32(raw)
+			if uint32(len(raw)-4) < n {
+				return fmt.Errorf("truncated record")
+			}
+			req.Sentences = append(req.Sentences, string(raw[4:4+n]))
+			raw = raw[4+n:]
+		}
+
+	case nexgenomics.ContentTypeJSONLines, nexgenomics.ContentTypeRecords:
+		sc := bufio.NewScanner(bytes.NewReader(raw))
+		sc.Buffer(nil, len(raw)+1)
+		for sc.Scan() {
+			if ct == nexgenomics.ContentTypeJSONLines {
+				var s string
+				if e := json.Unmarshal(sc.Bytes(), &s); e != nil {
+					return e
+				}
+				req.Sentences = append(req.Sentences, s)
+			} else {
+				var rec nexgenomics.Sentence
+				if e := json.Unmarshal(sc.Bytes(), &rec); e != nil {
+					return e
+				}
+				req.Records = append(req.Records, rec)
+				req.Sentences = append(req.Sentences, rec.Text)
+			}
+		}
+		return sc.Err()
+
+	default:
+		return fmt.Errorf("unsupported content type %q", ct)
+	}
+	return nil
+}
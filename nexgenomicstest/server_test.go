@@ -0,0 +1,40 @@
+package nexgenomicstest_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nexgenomics/go-nexgenomics"
+	"github.com/nexgenomics/go-nexgenomics/nexgenomicstest"
+)
+
+func TestServer(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	srv.AllowTokens("good")
+
+	bad := nexgenomics.NewWebhook("bad", srv.WebhookOptions()...)
+	if e := bad.SendSentences("one"); !errors.Is(e, nexgenomics.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", e)
+	}
+
+	srv.Fail(nexgenomicstest.Failure{Path: "/wh/sentences", Status: http.StatusBadGateway, Times: 2})
+	opts := append(srv.WebhookOptions(),
+		nexgenomics.WithRetry(nexgenomics.RetryPolicy{MaxAttempts: 3, InitialBackoff: 1}),
+		nexgenomics.WithFraming(nexgenomics.FramingLengthPrefixed),
+		nexgenomics.WithCompression(nexgenomics.CompressionZstd))
+	wh := nexgenomics.NewWebhook("good", opts...)
+	if e := wh.SendSentences("two\nlines", "three"); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	got := srv.Sentences()
+	if len(got) != 2 || got[0] != "two\nlines" || got[1] != "three" {
+		t.Errorf("unexpected sentences %q", got)
+	}
+	reqs := srv.Requests()
+	if len(reqs) != 4 || reqs[1].Status != http.StatusBadGateway || reqs[3].Status != http.StatusOK {
+		t.Errorf("unexpected requests %+v", reqs)
+	}
+}
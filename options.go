@@ -0,0 +1,227 @@
+package nexgenomics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultUserAgent is sent with every request unless overridden with WithUserAgent.
+const DefaultUserAgent = "go-nexgenomics"
+
+// conn holds the HTTP settings that every cloud client has in common.
+type conn struct {
+	service   string
+	baseurl   string
+	client    *resty.Client
+	timeout   time.Duration
+	useragent string
+	retry     RetryPolicy
+	limiter   *RateLimiter
+	tokens    TokenSource
+	transport *transport
+	logger    *slog.Logger
+	tracer    trace.TracerProvider
+	meter     metric.MeterProvider
+	tel       *telemetry
+}
+
+// Option configures any cloud client. It can be passed to NewWebhook and
+// to NewAgentstore.
+type Option func(*conn)
+
+// WebhookOption configures a Webhook created by NewWebhook. Every Option
+// is also a WebhookOption.
+type WebhookOption interface {
+	apply_webhook(*Webhook)
+}
+
+// AgentstoreOption configures an Agentstore created by NewAgentstore. Every
+// Option is also an AgentstoreOption.
+type AgentstoreOption interface {
+	apply_agentstore(*Agentstore)
+}
+
+func (o Option) apply_webhook(wh *Webhook)       { o(&wh.conn) }
+func (o Option) apply_agentstore(as *Agentstore) { o(&as.conn) }
+
+// webhook_option is a WebhookOption that only makes sense for a Webhook.
+type webhook_option func(*Webhook)
+
+func (o webhook_option) apply_webhook(wh *Webhook) { o(wh) }
+
+// WithBaseURL directs the client to a different host, such as a staging
+// deployment or a local stand-in. API paths are appended to it.
+func WithBaseURL(u string) Option {
+	return func(c *conn) {
+		c.baseurl = strings.TrimRight(u, "/")
+	}
+}
+
+// WithHTTPClient makes the client send its requests through hc, which may
+// be shared with other clients. The client never modifies hc, so transport
+// options such as WithProxy have no effect.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *conn) {
+		c.client = resty.NewWithClient(hc)
+	}
+}
+
+// WithTimeout bounds each request made by the client. It is applied per
+// request rather than to the HTTP client, so shared clients are left alone.
+func WithTimeout(d time.Duration) Option {
+	return func(c *conn) {
+		c.timeout = d
+	}
+}
+
+// WithUserAgent overrides the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return func(c *conn) {
+		c.useragent = ua
+	}
+}
+
+// WithRetry sets the retry policy applied to each request. For a Webhook,
+// that is each chunk.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *conn) {
+		c.retry = p
+	}
+}
+
+// WithRateLimiter throttles the client's requests through l. The same
+// limiter can be given to any number of clients that share a token.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(c *conn) {
+		c.limiter = l
+	}
+}
+
+// WithLogger logs each failed request attempt to l at debug level, and each
+// request that finally fails at warning level, as are chunks that a
+// WebhookOutbox gives up on. Nothing is logged by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *conn) {
+		c.logger = l
+	}
+}
+
+// new_conn returns the defaults for a client of the named service, which
+// lives at baseurl.
+func new_conn(service string, baseurl string) conn {
+	return conn{
+		service:   service,
+		baseurl:   baseurl,
+		useragent: DefaultUserAgent,
+		retry:     NoRetry,
+	}
+}
+
+// finish fills in anything the options left empty.
+func (c *conn) finish() {
+	if c.client == nil {
+		c.client = c.transport.new_client()
+	}
+	c.tel = new_telemetry(c.tracer, c.meter)
+}
+
+// execute makes a request to url, authorized with a token from ts, waiting
+// on the rate limiter and retrying according to the policy. build is called
+// for every attempt to set the request's headers and body. The response is
+// returned only on success. The whole exchange, retries included, is one span.
+func (c *conn) execute(ctx context.Context, ts TokenSource, method string, url string, build func(*resty.Request)) (*resty.Response, error) {
+	var resp *resty.Response
+
+	ctx, span := c.start_request(ctx, method, url)
+	attempts := 0
+	e := authorized(ctx, ts, func() error {
+		return c.retry.do(ctx, func() error {
+			var e error
+			attempts++
+			resp, e = c.attempt(ctx, ts, method, url, build)
+			if e != nil && c.logger != nil {
+				c.logger.DebugContext(ctx, "nexgenomics request attempt failed",
+					"service", c.service, "method", method, "url", url, "attempt", attempts, "error", e)
+			}
+			return e
+		})
+	})
+	end_span(span, e)
+	if e != nil && c.logger != nil {
+		c.logger.WarnContext(ctx, "nexgenomics request failed",
+			"service", c.service, "method", method, "url", url, "attempts", attempts, "error", e)
+	}
+	if e != nil {
+		return nil, e
+	}
+	return resp, nil
+}
+
+// attempt makes a single request.
+func (c *conn) attempt(ctx context.Context, ts TokenSource, method string, url string, build func(*resty.Request)) (*resty.Response, error) {
+	if e := ctx.Err(); e != nil {
+		return nil, e
+	}
+	token, e := ts.Token(ctx)
+	if e != nil {
+		return nil, &token_error{e}
+	}
+	if c.limiter != nil {
+		if e := c.limiter.Wait(ctx); e != nil {
+			return nil, e
+		}
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req := c.rest().R().
+		SetContext(ctx).
+		SetHeader("Authorization", fmt.Sprintf("Bearer %s", token)).
+		SetHeader("User-Agent", c.user_agent())
+	build(req)
+	inject(ctx, req)
+
+	start := time.Now()
+	resp, e := req.Execute(method, url)
+	if e != nil {
+		c.observe_attempt(ctx, method, start, body_size(req), nil, e)
+		return nil, e
+	}
+	if c.limiter != nil {
+		c.limiter.observe(resp)
+	}
+	e = check_response(resp)
+	c.observe_attempt(ctx, method, start, body_size(req), resp, e)
+	if e != nil {
+		return nil, e
+	}
+	return resp, nil
+}
+
+// rest returns the HTTP client, falling back to a fresh one for clients
+// that were built as struct literals rather than with their constructors.
+func (c *conn) rest() *resty.Client {
+	if c.client == nil {
+		return resty.New()
+	}
+	return c.client
+}
+
+// user_agent
+func (c *conn) user_agent() string {
+	if c.useragent == "" {
+		return DefaultUserAgent
+	}
+	return c.useragent
+}
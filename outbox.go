@@ -0,0 +1,414 @@
+package nexgenomics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOutboxFull is returned by WebhookOutbox.Enqueue when accepting the
+// sentences would take the outbox over its size limits.
+var ErrOutboxFull = errors.New("outbox full")
+
+const (
+	outbox_prefix   = "ob-"
+	outbox_suffix   = ".json"
+	rejected_suffix = ".rejected"
+
+	// DefaultOutboxMaxBytes bounds the total size of pending chunks.
+	DefaultOutboxMaxBytes = 1 << 30
+	// DefaultOutboxInterval is how often Run looks for pending chunks when
+	// nothing wakes it sooner.
+	DefaultOutboxInterval = 30 * time.Second
+)
+
+// WebhookOutbox is a durable queue in front of a Webhook. Enqueue writes
+// chunks to a local directory, and Run sends them in the background,
+// deleting each one once the server has accepted it. Chunks survive process
+// restarts, so sentences are not lost while the endpoint is unreachable.
+//
+// A chunk that the server rejects outright (a 4xx other than 401, 403, 408
+// or 429) would otherwise block the queue forever; it is renamed with a
+// ".rejected" suffix and left in the directory for inspection.
+type WebhookOutbox struct {
+	wh       *Webhook
+	dir      string
+	maxbytes int64
+	maxfiles int
+	interval time.Duration
+
+	mu    sync.Mutex
+	send  sync.Mutex
+	seq   uint64
+	depth OutboxDepth
+	wake  chan struct{}
+}
+
+// OutboxDepth reports how much is waiting in a WebhookOutbox.
+type OutboxDepth struct {
+	Chunks    int
+	Sentences int
+	Bytes     int64
+}
+
+// OutboxOption configures a WebhookOutbox.
+type OutboxOption func(*WebhookOutbox)
+
+// WithOutboxMaxBytes bounds the total size of the chunks on disk.
+func WithOutboxMaxBytes(n int64) OutboxOption {
+	return func(ob *WebhookOutbox) {
+		ob.maxbytes = n
+	}
+}
+
+// WithOutboxMaxChunks bounds the number of chunks on disk. Zero means no limit.
+func WithOutboxMaxChunks(n int) OutboxOption {
+	return func(ob *WebhookOutbox) {
+		ob.maxfiles = n
+	}
+}
+
+// WithOutboxInterval sets how often Run polls the directory.
+func WithOutboxInterval(d time.Duration) OutboxOption {
+	return func(ob *WebhookOutbox) {
+		ob.interval = d
+	}
+}
+
+// outbox_entry is the on-disk form of a pending chunk.
+type outbox_entry struct {
+	ContentType     string    `json:"content_type"`
+	ContentEncoding string    `json:"content_encoding,omitempty"`
+	IdempotencyKey  string    `json:"idempotency_key"`
+	Sentences       int       `json:"sentences"`
+	CreatedAt       time.Time `json:"created_at"`
+	Body            []byte    `json:"body"`
+}
+
+// NewWebhookOutbox returns an outbox that keeps its chunks in dir, creating
+// the directory if needed. Chunks left by an earlier process are picked up
+// and will be sent by Run.
+func NewWebhookOutbox(wh *Webhook, dir string, opts ...OutboxOption) (*WebhookOutbox, error) {
+	ob := &WebhookOutbox{
+		wh:       wh,
+		dir:      dir,
+		maxbytes: DefaultOutboxMaxBytes,
+		interval: DefaultOutboxInterval,
+		wake:     make(chan struct{}, 1),
+	}
+	for _, o := range opts {
+		o(ob)
+	}
+
+	if e := os.MkdirAll(dir, 0o755); e != nil {
+		return nil, e
+	}
+
+	files, e := ob.pending()
+	if e != nil {
+		return nil, e
+	}
+	for _, f := range files {
+		if ent, e := read_outbox_entry(f); e == nil {
+			ob.depth.Chunks++
+			ob.depth.Sentences += ent.Sentences
+			ob.depth.Bytes += int64(len(ent.Body))
+		}
+	}
+
+	// rejected chunks keep their sequence numbers, so they are counted too
+	// or a later rejection could be renamed over one of them.
+	rejected, e := filepath.Glob(filepath.Join(dir, outbox_prefix+"*"+outbox_suffix+rejected_suffix))
+	if e != nil {
+		return nil, e
+	}
+	for _, f := range append(files, rejected...) {
+		name := strings.TrimSuffix(filepath.Base(f), rejected_suffix)
+		if n, e := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, outbox_prefix), outbox_suffix), 10, 64); e == nil && n > ob.seq {
+			ob.seq = n
+		}
+	}
+
+	return ob, nil
+}
+
+// Depth reports what is waiting to be sent.
+func (ob *WebhookOutbox) Depth() OutboxDepth {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.depth
+}
+
+// Enqueue chunks the sentences exactly as the Webhook would and writes the
+// chunks to disk. Either every chunk is written or none is: if the outbox
+// would exceed its limits ErrOutboxFull is returned, and if a write fails
+// the chunks already written are removed before the error is returned.
+func (ob *WebhookOutbox) Enqueue(ctx context.Context, sentences ...string) error {
+	b, e := ob.wh.sentence_batch(sentences, nil)
+	if e != nil {
+		return e
+	}
+	return ob.enqueue(ctx, b)
+}
+
+// EnqueueRecords is Enqueue for structured sentences.
+func (ob *WebhookOutbox) EnqueueRecords(ctx context.Context, records []Sentence) error {
+	b, e := ob.wh.record_batch(records)
+	if e != nil {
+		return e
+	}
+	return ob.enqueue(ctx, b)
+}
+
+// enqueue
+func (ob *WebhookOutbox) enqueue(ctx context.Context, b *batch) error {
+	if e := ctx.Err(); e != nil {
+		return e
+	}
+
+	entries := []outbox_entry{}
+	chunks := []chunk{}
+	size := int64(0)
+
+	c := ob.wh.new_chunker(b)
+	for {
+		ch, ok, e := c.next()
+		if e != nil {
+			return e
+		}
+		if !ok {
+			break
+		}
+		chunks = append(chunks, ch)
+		entries = append(entries, outbox_entry{
+			ContentType:     b.content_type,
+			ContentEncoding: ob.wh.compression.content_encoding(),
+			IdempotencyKey:  new_idempotency_key(),
+			Sentences:       ch.End - ch.Start,
+			CreatedAt:       time.Now().UTC(),
+			Body:            ch.body,
+		})
+		size += int64(len(ch.body))
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if ob.depth.Bytes+size > ob.maxbytes || (ob.maxfiles > 0 && ob.depth.Chunks+len(entries) > ob.maxfiles) {
+		return ErrOutboxFull
+	}
+
+	// If a write fails, the chunks already written are removed again so
+	// that a caller who retries does not queue them twice.
+	written := []string{}
+	for _, ent := range entries {
+		ob.seq++
+		path := ob.path(ob.seq)
+		if e := write_outbox_entry(path, &ent); e != nil {
+			errs := []error{e}
+			for _, w := range written {
+				errs = append(errs, os.Remove(w))
+			}
+			if len(written) > 0 {
+				errs = append(errs, sync_dir(ob.dir))
+			}
+			return errors.Join(errs...)
+		}
+		written = append(written, path)
+	}
+	for _, ent := range entries {
+		ob.depth.Chunks++
+		ob.depth.Sentences += ent.Sentences
+		ob.depth.Bytes += int64(len(ent.Body))
+	}
+	for _, ch := range chunks {
+		ob.wh.report_redactions(b, ch)
+	}
+	// Once on disk, the sentences will be delivered, so they count as sent.
+	ob.wh.skipped.Add(int64(b.skipped))
+	ob.wh.mark_sent(b, []SentenceRange{{Start: 0, End: len(b.records)}})
+
+	select {
+	case ob.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run sends pending chunks until ctx is done. It wakes when chunks are
+// enqueued, every poll interval, and after failures with exponential backoff.
+func (ob *WebhookOutbox) Run(ctx context.Context) error {
+	failures := 0
+	for {
+		delay := ob.interval
+		if e := ob.Flush(ctx); e != nil && ctx.Err() == nil {
+			failures++
+			delay = DefaultRetryPolicy.backoff(failures)
+		} else {
+			failures = 0
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-ob.wake:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+}
+
+// Flush makes one pass over the outbox, sending chunks in the order they
+// were enqueued and stopping at the first one that cannot be delivered.
+func (ob *WebhookOutbox) Flush(ctx context.Context) error {
+	ob.send.Lock()
+	defer ob.send.Unlock()
+
+	files, e := ob.pending()
+	if e != nil {
+		return e
+	}
+
+	for _, f := range files {
+		ent, e := read_outbox_entry(f)
+		if e != nil {
+			// A torn or corrupt file can never be sent. Keep it for inspection.
+			ob.warn(ctx, "outbox chunk unreadable", "path", f, "error", e)
+			if e := os.Rename(f, f+rejected_suffix); e != nil {
+				return fmt.Errorf("outbox: %w", e)
+			}
+			continue
+		}
+
+		e = ob.wh.post(ctx, ent.ContentType, ent.ContentEncoding, ent.Body, ent.IdempotencyKey)
+		if e != nil && !outbox_rejected(e) {
+			return e
+		}
+		// Until the file is gone the chunk stays counted, and a delivered
+		// chunk is sent again, under the same idempotency key.
+		if e != nil {
+			ob.warn(ctx, "outbox chunk rejected", "path", f, "error", e)
+			if e := os.Rename(f, f+rejected_suffix); e != nil {
+				return fmt.Errorf("outbox: %w", e)
+			}
+		} else if e := os.Remove(f); e != nil {
+			return fmt.Errorf("outbox: %w", e)
+		}
+
+		ob.mu.Lock()
+		ob.depth.Chunks--
+		ob.depth.Sentences -= ent.Sentences
+		ob.depth.Bytes -= int64(len(ent.Body))
+		ob.mu.Unlock()
+	}
+
+	return nil
+}
+
+// warn logs through the Webhook's logger, if it has one.
+func (ob *WebhookOutbox) warn(ctx context.Context, msg string, args ...any) {
+	if l := ob.wh.logger; l != nil {
+		l.WarnContext(ctx, msg, args...)
+	}
+}
+
+// outbox_rejected reports whether the server refused a chunk in a way that
+// retrying will not fix. Authorization failures are excluded because a
+// rotated token can fix them.
+func outbox_rejected(e error) bool {
+	if retry, _ := retryable(e); retry {
+		return false
+	}
+	var ae *APIError
+	return errors.As(e, &ae) && !errors.Is(e, ErrUnauthorized)
+}
+
+// pending returns the chunk files in the order they were enqueued.
+func (ob *WebhookOutbox) pending() ([]string, error) {
+	files, e := filepath.Glob(filepath.Join(ob.dir, outbox_prefix+"*"+outbox_suffix))
+	if e != nil {
+		return nil, e
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// path
+func (ob *WebhookOutbox) path(seq uint64) string {
+	return filepath.Join(ob.dir, fmt.Sprintf("%s%020d%s", outbox_prefix, seq, outbox_suffix))
+}
+
+// write_outbox_entry writes atomically and durably: the data is synced
+// before the rename and the directory after it, so a crash or power loss
+// never leaves a partial or empty chunk where Flush would find it. On error
+// nothing is left at path.
+func write_outbox_entry(path string, ent *outbox_entry) error {
+	data, e := json.Marshal(ent)
+	if e != nil {
+		return e
+	}
+	tmp := path + ".tmp"
+	f, e := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if e != nil {
+		return e
+	}
+	_, e = f.Write(data)
+	if e == nil {
+		e = f.Sync()
+	}
+	if err := f.Close(); e == nil {
+		e = err
+	}
+	if e == nil {
+		e = os.Rename(tmp, path)
+	}
+	if e != nil {
+		os.Remove(tmp)
+		return e
+	}
+	if e := sync_dir(filepath.Dir(path)); e != nil {
+		return errors.Join(e, os.Remove(path))
+	}
+	return nil
+}
+
+// sync_dir makes the directory entries in dir durable. Windows cannot sync
+// a directory, and does not need to.
+func sync_dir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, e := os.Open(dir)
+	if e != nil {
+		return e
+	}
+	e = d.Sync()
+	if err := d.Close(); e == nil {
+		e = err
+	}
+	return e
+}
+
+// read_outbox_entry
+func read_outbox_entry(path string) (*outbox_entry, error) {
+	data, e := os.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+	var ent outbox_entry
+	if e := json.Unmarshal(data, &ent); e != nil {
+		return nil, e
+	}
+	return &ent, nil
+}
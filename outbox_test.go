@@ -0,0 +1,175 @@
+package nexgenomics_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+func TestWebhookOutbox(t *testing.T) {
+	var mu sync.Mutex
+	up := false
+	got := []string{}
+	keys := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys[r.Header.Get("Idempotency-Key")]++
+		if !up {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		got = append(got, string(b))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	h := nexgenomics.NewWebhook("abc", nexgenomics.WithBaseURL(srv.URL))
+	ob, e := nexgenomics.NewWebhookOutbox(h, dir, nexgenomics.WithOutboxMaxBytes(64))
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	ctx := context.Background()
+	if e := ob.Enqueue(ctx, "This is thing 1", "This is thing 2"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := ob.Enqueue(ctx, "This is thing 3"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := ob.Enqueue(ctx, string(make([]byte, 64))); !errors.Is(e, nexgenomics.ErrOutboxFull) {
+		t.Errorf("expected ErrOutboxFull, got %v", e)
+	}
+
+	// The endpoint is down, so the chunks stay queued.
+	if e := ob.Flush(ctx); e == nil {
+		t.Errorf("expected flush to fail")
+	}
+	if d := ob.Depth(); d.Chunks != 2 || d.Sentences != 3 {
+		t.Errorf("unexpected depth %+v", d)
+	}
+
+	// A new outbox over the same directory picks up the pending chunks.
+	ob, e = nexgenomics.NewWebhookOutbox(h, dir, nexgenomics.WithOutboxInterval(5*time.Millisecond))
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	if d := ob.Depth(); d.Chunks != 2 {
+		t.Errorf("unexpected depth after reopening %+v", d)
+	}
+
+	mu.Lock()
+	up = true
+	mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	go ob.Run(ctx)
+	for ob.Depth().Chunks > 0 && ctx.Err() == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0] != "This is thing 1\nThis is thing 2" || got[1] != "This is thing 3" {
+		t.Errorf("unexpected bodies %q", got)
+	}
+	// The failed attempt and its replay share a key.
+	if len(keys) != 2 {
+		t.Errorf("expected 2 idempotency keys, got %v", keys)
+	}
+}
+
+func TestWebhookOutboxPartialWrite(t *testing.T) {
+	dir := t.TempDir()
+	reports := 0
+	h := nexgenomics.NewWebhook("abc", nexgenomics.WithMaxChunkSize(16),
+		nexgenomics.WithRedactionAudit(func(nexgenomics.RedactionReport) { reports++ }))
+	ob, e := nexgenomics.NewWebhookOutbox(h, dir)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	// A directory in the way of the second chunk's temporary file makes
+	// its write fail after the first chunk is on disk.
+	if e := os.Mkdir(filepath.Join(dir, "ob-00000000000000000002.json.tmp"), 0o755); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := os.WriteFile(filepath.Join(dir, "ob-00000000000000000002.json.tmp", "x"), nil, 0o644); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := ob.Enqueue(context.Background(), "This is thing 1", "This is thing 2"); e == nil {
+		t.Fatalf("expected the enqueue to fail")
+	}
+
+	if d := ob.Depth(); d.Chunks != 0 || d.Sentences != 0 {
+		t.Errorf("unexpected depth %+v", d)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "ob-*.json")); len(files) != 0 {
+		t.Errorf("chunks left behind: %v", files)
+	}
+	if reports != 0 {
+		t.Errorf("audited %d chunks that were never queued", reports)
+	}
+}
+
+func TestWebhookOutboxRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	var logged bytes.Buffer
+	dir := t.TempDir()
+	h := nexgenomics.NewWebhook("abc",
+		nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithLogger(slog.New(slog.NewTextHandler(&logged, nil))))
+	ob, e := nexgenomics.NewWebhookOutbox(h, dir)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	ctx := context.Background()
+	if e := ob.Enqueue(ctx, "rejected"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	os.WriteFile(filepath.Join(dir, "ob-00000000000000000009.json"), []byte("torn"), 0o644)
+
+	if e := ob.Flush(ctx); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if d := ob.Depth(); d.Chunks != 0 {
+		t.Errorf("unexpected depth %+v", d)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.rejected")); len(files) != 2 {
+		t.Errorf("expected 2 rejected chunks, got %v", files)
+	}
+	if out := logged.String(); !strings.Contains(out, "outbox chunk rejected") || !strings.Contains(out, "outbox chunk unreadable") {
+		t.Errorf("unexpected log %q", out)
+	}
+
+	// after a restart, new chunks are numbered past the rejected ones.
+	ob, e = nexgenomics.NewWebhookOutbox(h, dir)
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	if e := ob.Enqueue(ctx, "rejected again"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	ob.Flush(ctx)
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.rejected")); len(files) != 3 {
+		t.Errorf("expected 3 rejected chunks, got %v", files)
+	}
+}
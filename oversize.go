@@ -0,0 +1,233 @@
+package nexgenomics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxChunkSize is the largest request body the Webhook sends unless
+// changed with WithMaxChunkSize.
+const DefaultMaxChunkSize = 500_000
+
+// ErrSentenceTooLarge is returned when a single sentence cannot fit in a
+// chunk and the oversize policy is OversizeReject.
+var ErrSentenceTooLarge = errors.New("sentence exceeds the maximum chunk size")
+
+// OversizePolicy decides what happens to a sentence that is too large to
+// fit in a chunk on its own.
+type OversizePolicy int
+
+const (
+	// OversizeReject fails the upload with ErrSentenceTooLarge before
+	// anything is sent. It is the default.
+	OversizeReject OversizePolicy = iota
+
+	// OversizeSplit breaks the sentence into pieces that fit, preferring
+	// to break after sentence punctuation, then at whitespace, and never
+	// inside a UTF-8 character. Each piece is sent as its own sentence.
+	OversizeSplit
+)
+
+// WithMaxChunkSize sets the hard limit on the size of each request body.
+// With compression the limit applies to the compressed body.
+func WithMaxChunkSize(n int) WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.maxchunk = n
+	})
+}
+
+// WithOversizePolicy sets how sentences larger than the chunk limit are handled.
+func WithOversizePolicy(p OversizePolicy) WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.oversize = p
+	})
+}
+
+// max_chunk
+func (wh *Webhook) max_chunk() int {
+	if wh.maxchunk <= 0 {
+		return DefaultMaxChunkSize
+	}
+	return wh.maxchunk
+}
+
+// batch is a run of encoded records bound for one content type.
+type batch struct {
+	content_type string
+	sep          []byte
+	records      [][]byte
+	origin       []int            // index of the caller's sentence that each record came from
+	redactions   []map[string]int // redactions made in each record, counted on the first piece of a split sentence
+	hashes       [][32]byte       // content hash for dedup, set on every piece of a split sentence
+	seen         map[[32]byte]bool
+	skipped      int // duplicates left out, counted once the batch is sent
+}
+
+// append adds the records of o to b. The origins of o are not kept.
+func (b *batch) append(o *batch) {
+	b.records = append(b.records, o.records...)
+	b.redactions = append(b.redactions, o.redactions...)
+	b.hashes = append(b.hashes, o.hashes...)
+	b.skipped += o.skipped
+}
+
+// sentence_batch encodes sentences with the Webhook's framing. Sentences
+// whose hash is in seen are duplicates; seen may be nil.
+func (wh *Webhook) sentence_batch(sentences []string, seen map[[32]byte]bool) (*batch, error) {
+	f := wh.framing
+	b := &batch{content_type: f.content_type(), sep: f.separator(), seen: seen}
+	e := wh.encode_texts(b, len(sentences),
+		func(i int) string { return sentences[i] },
+		func(i int, text string) ([]byte, error) { return f.encode(text) })
+	return b, e
+}
+
+// record_batch encodes structured sentences as JSON Lines. A record that is
+// split keeps its metadata on every piece.
+func (wh *Webhook) record_batch(records []Sentence) (*batch, error) {
+	b := &batch{content_type: ContentTypeRecords}
+	e := wh.encode_texts(b, len(records),
+		func(i int) string { return records[i].Text },
+		func(i int, text string) ([]byte, error) {
+			r := records[i]
+			r.Text = text
+			return encode_json_line(&r)
+		})
+	return b, e
+}
+
+// encode_texts appends n encoded items to b, applying the oversize policy
+// to any item whose encoding cannot fit in a chunk by itself.
+// An item that cannot be encoded fails the whole batch.
+func (wh *Webhook) encode_texts(b *batch, n int, text func(int) string, encode func(int, string) ([]byte, error)) error {
+	limit := wh.max_chunk()
+	size := func(r []byte) int {
+		if wh.compression == CompressionNone || len(r)+len(r)/1000+64 <= limit {
+			// compression expands incompressible data by a few bytes at
+			// worst, so anything comfortably under the limit fits.
+			return len(r)
+		}
+		body, e := wh.compression.compress(r)
+		if e != nil {
+			return len(r)
+		}
+		return len(body)
+	}
+
+	if b.seen == nil {
+		b.seen = map[[32]byte]bool{}
+	}
+	for i := range n {
+		t, counts := wh.redact(text(i))
+		r, e := encode(i, t)
+		if e != nil {
+			return fmt.Errorf("sentence %d: %w", i, e)
+		}
+
+		var h [32]byte
+		if wh.dedup != nil {
+			h = content_hash(r)
+			if b.seen[h] || wh.dedup.Contains(h) {
+				b.skipped++
+				continue
+			}
+		}
+
+		if sz := size(r); sz > limit {
+			if wh.oversize != OversizeSplit {
+				return fmt.Errorf("sentence %d is %d bytes, limit %d: %w", i, sz, limit, ErrSentenceTooLarge)
+			}
+			pieces, e := split_text(t, func(s string) bool {
+				r, e := encode(i, s)
+				return e == nil && size(r) <= limit
+			})
+			if e != nil {
+				return fmt.Errorf("sentence %d: %w", i, e)
+			}
+			for j, p := range pieces {
+				r, e := encode(i, p)
+				if e != nil {
+					return fmt.Errorf("sentence %d: %w", i, e)
+				}
+				b.records = append(b.records, r)
+				b.origin = append(b.origin, i)
+				if j == 0 {
+					b.redactions = append(b.redactions, counts)
+				} else {
+					b.redactions = append(b.redactions, nil)
+				}
+				b.hashes = append(b.hashes, h)
+			}
+		} else {
+			b.records = append(b.records, r)
+			b.origin = append(b.origin, i)
+			b.redactions = append(b.redactions, counts)
+			b.hashes = append(b.hashes, h)
+		}
+		if wh.dedup != nil {
+			b.seen[h] = true
+		}
+	}
+	return nil
+}
+
+// split_text breaks s into pieces for which fits is true, each as long as
+// possible while ending on a safe boundary.
+func split_text(s string, fits func(string) bool) ([]string, error) {
+	pieces := []string{}
+	for len(s) > 0 {
+		if fits(s) {
+			pieces = append(pieces, s)
+			break
+		}
+
+		// longest prefix that fits, by binary search.
+		lo, hi := 0, len(s)
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if fits(s[:mid]) {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		n := safe_boundary(s, lo)
+		if n == 0 {
+			return nil, ErrSentenceTooLarge
+		}
+		pieces = append(pieces, s[:n])
+		s = s[n:]
+	}
+	return pieces, nil
+}
+
+// safe_boundary returns the best place at or before n to break s. It looks
+// for the end of a sentence, then whitespace, in the second half of the
+// prefix so pieces stay large, and otherwise backs off to the start of a
+// UTF-8 character.
+func safe_boundary(s string, n int) int {
+	prefix := s[:n]
+	if i := strings.LastIndexAny(prefix, ".!?\n"); i >= n/2 && i+1 <= n {
+		return i + 1
+	}
+	if i := strings.LastIndexFunc(prefix, unicode.IsSpace); i >= n/2 {
+		_, w := utf8.DecodeRuneInString(prefix[i:])
+		return i + w
+	}
+	for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+// map_range converts a range of records into the range of caller sentences
+// they came from.
+func (b *batch) map_range(r SentenceRange) SentenceRange {
+	if b.origin == nil || r.End <= r.Start {
+		return r
+	}
+	return SentenceRange{Start: b.origin[r.Start], End: b.origin[r.End-1] + 1}
+}
@@ -0,0 +1,137 @@
+package nexgenomics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// RateLimiter is a token bucket that throttles requests on the client side.
+// One limiter is normally shared by every client that uses the same token,
+// and it is safe for concurrent use.
+//
+// The limiter adapts to the server. A 429 response pauses it for the
+// Retry-After period and halves its rate; the rate then recovers a little
+// with every successful response. An X-RateLimit-Remaining header of zero
+// pauses it until the time given by X-RateLimit-Reset.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  float64 // configured requests per second
+	rate   float64 // current requests per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	paused time.Time
+}
+
+// NewRateLimiter returns a limiter that allows rate requests per second on
+// average, with bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		limit:  rate,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be made or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		d := l.reserve()
+		if d <= 0 {
+			return nil
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve takes a token if one is available, and otherwise returns how long
+// to wait before trying again.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.paused) {
+		return l.paused.Sub(now)
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	if l.rate <= 0 {
+		return time.Second
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// observe adapts the limiter to a response.
+func (l *RateLimiter) observe(resp *resty.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	h := resp.Header()
+
+	if resp.StatusCode() == 429 {
+		wait := parse_retry_after(h.Get("Retry-After"))
+		if wait <= 0 {
+			wait = time.Second
+		}
+		l.pause_until(now.Add(wait))
+		l.rate = max(l.rate/2, l.limit/16)
+		l.tokens = 0
+		return
+	}
+
+	if rem, e := strconv.Atoi(h.Get("X-RateLimit-Remaining")); e == nil && rem <= 0 {
+		if reset := parse_rate_limit_reset(h.Get("X-RateLimit-Reset"), now); !reset.IsZero() {
+			l.pause_until(reset)
+		}
+	}
+
+	if resp.StatusCode() < 400 && l.rate < l.limit {
+		l.rate = min(l.rate+l.limit/20, l.limit)
+	}
+}
+
+// pause_until ASSUMES the lock is held.
+func (l *RateLimiter) pause_until(t time.Time) {
+	if t.After(l.paused) {
+		l.paused = t
+	}
+}
+
+// parse_rate_limit_reset reads X-RateLimit-Reset, which servers give either
+// as seconds from now or as a Unix timestamp.
+func parse_rate_limit_reset(h string, now time.Time) time.Time {
+	n, e := strconv.ParseInt(h, 10, 64)
+	if e != nil || n < 0 {
+		return time.Time{}
+	}
+	if n > 1_000_000_000 {
+		return time.Unix(n, 0)
+	}
+	return now.Add(time.Duration(n) * time.Second)
+}
@@ -0,0 +1,51 @@
+package nexgenomics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+func TestRateLimiter(t *testing.T) {
+	remaining := "10"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", remaining)
+		w.Header().Set("X-RateLimit-Reset", "1")
+		if r.URL.Path == "/api/agents" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer srv.Close()
+
+	// One limiter shared by both clients: 50 requests per second, no bursts.
+	l := nexgenomics.NewRateLimiter(50, 1)
+	h := nexgenomics.NewWebhook("abc", nexgenomics.WithBaseURL(srv.URL), nexgenomics.WithRateLimiter(l))
+	as := nexgenomics.NewAgentstore("abc", nexgenomics.WithBaseURL(srv.URL), nexgenomics.WithRateLimiter(l))
+
+	start := time.Now()
+	for range 3 {
+		if e := h.SendSentences("one"); e != nil {
+			t.Fatalf("%s", e)
+		}
+		if _, e := as.Agents(); e != nil {
+			t.Fatalf("%s", e)
+		}
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("6 requests at 50/s took only %v", d)
+	}
+
+	// The server says we are out of requests until the reset.
+	remaining = "0"
+	h.SendSentences("one")
+	remaining = "10"
+	start = time.Now()
+	h.SendSentences("two")
+	if d := time.Since(start); d < 500*time.Millisecond {
+		t.Errorf("expected to wait for the rate limit reset, waited %v", d)
+	}
+}
@@ -0,0 +1,277 @@
+package nexgenomics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers on events delivered by the NexGenomics platform.
+const (
+	SignatureHeader = "X-Nexgenomics-Signature" // "sha256=" and the hex HMAC of timestamp + "." + body
+	TimestampHeader = "X-Nexgenomics-Timestamp" // Unix seconds
+)
+
+// DefaultReceiverTolerance is how old, or how far in the future, a delivery's
+// timestamp may be before the Receiver refuses it.
+const DefaultReceiverTolerance = 5 * time.Minute
+
+// max_event_size bounds the body the Receiver will read.
+const max_event_size = 1 << 20
+
+// Event types sent by the platform.
+const (
+	EventAgentStatus       = "agent.status_changed"
+	EventSentencesIngested = "sentences.ingested"
+	EventTokenExpiring     = "token.expiring"
+)
+
+// Event is a delivery from the NexGenomics platform. Payload holds the data
+// decoded into the type registered for the event type (see the Event*Data
+// types), or nil for types the SDK does not know; Data always holds the raw
+// JSON.
+type Event struct {
+	Id        string          `json:"id"`
+	Type      string          `json:"type"`
+	AgentId   string          `json:"agent_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+
+	Payload any `json:"-"`
+}
+
+// AgentStatusData is the payload of EventAgentStatus.
+type AgentStatusData struct {
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// SentencesIngestedData is the payload of EventSentencesIngested.
+type SentencesIngestedData struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
+
+// TokenExpiringData is the payload of EventTokenExpiring.
+type TokenExpiringData struct {
+	TokenId   string    `json:"token_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// payload_types maps event types to the types their data decodes into.
+var payload_types = map[string]func() any{
+	EventAgentStatus:       func() any { return &AgentStatusData{} },
+	EventSentencesIngested: func() any { return &SentencesIngestedData{} },
+	EventTokenExpiring:     func() any { return &TokenExpiringData{} },
+}
+
+// EventHandler handles a verified event. Returning an error makes the
+// Receiver answer 500, so the platform delivers the event again later.
+type EventHandler func(ctx context.Context, ev *Event) error
+
+// Receiver is an http.Handler for events that the NexGenomics platform
+// pushes to your service. It checks each delivery's HMAC signature and
+// timestamp, refuses replays of deliveries it has already accepted, decodes
+// the payload and passes the event to the handlers registered for its type.
+// A redelivery that arrives while the first is still being handled gets 409
+// Conflict, so the platform tries it again later.
+type Receiver struct {
+	secret    []byte
+	tolerance time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	handlers map[string][]EventHandler
+	seen     map[string]time.Time
+	inflight map[string]bool
+}
+
+// ReceiverOption configures a Receiver.
+type ReceiverOption func(*Receiver)
+
+// WithTolerance sets how far a delivery's timestamp may be from the local
+// clock. Replay protection remembers deliveries for the same period.
+func WithTolerance(d time.Duration) ReceiverOption {
+	return func(r *Receiver) {
+		r.tolerance = d
+	}
+}
+
+// NewReceiver returns a Receiver that verifies deliveries signed with secret.
+func NewReceiver(secret []byte, opts ...ReceiverOption) *Receiver {
+	r := &Receiver{
+		secret:    secret,
+		tolerance: DefaultReceiverTolerance,
+		now:       time.Now,
+		handlers:  map[string][]EventHandler{},
+		seen:      map[string]time.Time{},
+		inflight:  map[string]bool{},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// On registers a handler for an event type. The type "*" matches every event.
+func (r *Receiver) On(event_type string, h EventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[event_type] = append(r.handlers[event_type], h)
+}
+
+// ServeHTTP
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, e := io.ReadAll(io.LimitReader(req.Body, max_event_size+1))
+	if e != nil {
+		http.Error(w, "unreadable body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > max_event_size {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if e := r.Verify(req.Header.Get(TimestampHeader), req.Header.Get(SignatureHeader), body); e != nil {
+		http.Error(w, e.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var ev Event
+	if e := json.Unmarshal(body, &ev); e != nil || ev.Id == "" || ev.Type == "" {
+		http.Error(w, "malformed event", http.StatusBadRequest)
+		return
+	}
+	if mk, ok := payload_types[ev.Type]; ok && len(ev.Data) > 0 {
+		p := mk()
+		if e := json.Unmarshal(ev.Data, p); e != nil {
+			http.Error(w, "malformed event data", http.StatusBadRequest)
+			return
+		}
+		ev.Payload = p
+	}
+
+	switch r.begin(ev.Id) {
+	case delivery_handled:
+		// Already handled; acknowledge so the platform stops sending it.
+		w.WriteHeader(http.StatusOK)
+		return
+	case delivery_in_progress:
+		http.Error(w, "delivery in progress", http.StatusConflict)
+		return
+	}
+
+	e = r.dispatch(req.Context(), &ev)
+	r.end(ev.Id, e == nil)
+	if e != nil {
+		http.Error(w, "handler failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Verify checks a delivery's timestamp and signature headers against its body.
+func (r *Receiver) Verify(timestamp string, signature string, body []byte) error {
+	ts, e := strconv.ParseInt(timestamp, 10, 64)
+	if e != nil {
+		return fmt.Errorf("missing or malformed timestamp")
+	}
+	if d := r.now().Sub(time.Unix(ts, 0)); d > r.tolerance || d < -r.tolerance {
+		return fmt.Errorf("timestamp outside tolerance")
+	}
+
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return fmt.Errorf("missing or malformed signature")
+	}
+	got, e := hex.DecodeString(sig)
+	if e != nil {
+		return fmt.Errorf("missing or malformed signature")
+	}
+	if !hmac.Equal(got, Sign(r.secret, timestamp, body)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// Sign computes the signature the platform sends for a delivery. It is
+// exported for tests that need to produce signed deliveries.
+func Sign(secret []byte, timestamp string, body []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(timestamp))
+	m.Write([]byte("."))
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+// delivery_state is what the Receiver knows about an event id.
+type delivery_state int
+
+const (
+	delivery_new delivery_state = iota
+	delivery_in_progress
+	delivery_handled
+)
+
+// begin marks an event id as being handled, unless it already is or has
+// been. Handled ids older than the tolerance are dropped, since deliveries
+// that old fail the timestamp check anyway.
+func (r *Receiver) begin(id string) delivery_state {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for k, t := range r.seen {
+		if now.Sub(t) > 2*r.tolerance {
+			delete(r.seen, k)
+		}
+	}
+	if _, ok := r.seen[id]; ok {
+		return delivery_handled
+	}
+	if r.inflight[id] {
+		return delivery_in_progress
+	}
+	r.inflight[id] = true
+	return delivery_new
+}
+
+// end finishes handling an event id. Only a delivery that was handled is
+// remembered; a failed one may be retried.
+func (r *Receiver) end(id string, handled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.inflight, id)
+	if handled {
+		r.seen[id] = r.now()
+	}
+}
+
+// dispatch
+func (r *Receiver) dispatch(ctx context.Context, ev *Event) error {
+	r.mu.Lock()
+	hs := append(append([]EventHandler{}, r.handlers[ev.Type]...), r.handlers["*"]...)
+	r.mu.Unlock()
+
+	for _, h := range hs {
+		if e := h(ctx, ev); e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package nexgenomics_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+func TestReceiver(t *testing.T) {
+	secret := []byte("shh")
+	rcv := nexgenomics.NewReceiver(secret)
+
+	got := []*nexgenomics.AgentStatusData{}
+	rcv.On(nexgenomics.EventAgentStatus, func(ctx context.Context, ev *nexgenomics.Event) error {
+		got = append(got, ev.Payload.(*nexgenomics.AgentStatusData))
+		return nil
+	})
+
+	body := `{"id":"ev-1","type":"agent.status_changed","agent_id":"a1","data":{"previous":"stopped","current":"running"}}`
+	deliver := func(ts time.Time, sign []byte) int {
+		stamp := strconv.FormatInt(ts.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+		req.Header.Set(nexgenomics.TimestampHeader, stamp)
+		req.Header.Set(nexgenomics.SignatureHeader, "sha256="+hex.EncodeToString(nexgenomics.Sign(sign, stamp, []byte(body))))
+		w := httptest.NewRecorder()
+		rcv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if sc := deliver(time.Now(), []byte("wrong")); sc != http.StatusUnauthorized {
+		t.Errorf("bad signature: got %d", sc)
+	}
+	if sc := deliver(time.Now().Add(-time.Hour), secret); sc != http.StatusUnauthorized {
+		t.Errorf("stale timestamp: got %d", sc)
+	}
+	if sc := deliver(time.Now(), secret); sc != http.StatusOK {
+		t.Errorf("valid delivery: got %d", sc)
+	}
+	if sc := deliver(time.Now(), secret); sc != http.StatusOK {
+		t.Errorf("replayed delivery: got %d", sc)
+	}
+
+	if len(got) != 1 || got[0].Current != "running" {
+		t.Errorf("expected one decoded event, got %+v", got)
+	}
+}
+
+func TestReceiverRedelivery(t *testing.T) {
+	secret := []byte("shh")
+	rcv := nexgenomics.NewReceiver(secret)
+
+	started := make(chan struct{})
+	release := make(chan error)
+	calls := 0
+	rcv.On("*", func(ctx context.Context, ev *nexgenomics.Event) error {
+		calls++
+		started <- struct{}{}
+		return <-release
+	})
+
+	body := `{"id":"ev-2","type":"sentences.ingested","data":{"accepted":3}}`
+	deliver := func() int {
+		stamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+		req.Header.Set(nexgenomics.TimestampHeader, stamp)
+		req.Header.Set(nexgenomics.SignatureHeader, "sha256="+hex.EncodeToString(nexgenomics.Sign(secret, stamp, []byte(body))))
+		w := httptest.NewRecorder()
+		rcv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// a redelivery while the first is being handled is not acknowledged.
+	first := make(chan int)
+	go func() { first <- deliver() }()
+	<-started
+	if sc := deliver(); sc != http.StatusConflict {
+		t.Errorf("concurrent redelivery: got %d", sc)
+	}
+	release <- errors.New("downstream unavailable")
+	if sc := <-first; sc != http.StatusInternalServerError {
+		t.Errorf("failed delivery: got %d", sc)
+	}
+
+	// after a failure the event is handled again, and then only acknowledged.
+	go func() { <-started; release <- nil }()
+	if sc := deliver(); sc != http.StatusOK {
+		t.Errorf("retried delivery: got %d", sc)
+	}
+	if sc := deliver(); sc != http.StatusOK || calls != 2 {
+		t.Errorf("replayed delivery: got %d after %d calls", sc, calls)
+	}
+}
@@ -0,0 +1,33 @@
+package nexgenomics
+
+import (
+	"context"
+	"time"
+)
+
+// ContentTypeRecords is the content type of structured sentence uploads:
+// one JSON-encoded Sentence per line.
+const ContentTypeRecords = "application/vnd.nexgenomics.records+jsonl"
+
+// Sentence is a sentence with the metadata that describes where it came from.
+// Only Text is required.
+type Sentence struct {
+	Text       string    `json:"text"`
+	DocumentId string    `json:"document_id,omitempty"`
+	Timestamp  time.Time `json:"timestamp,omitzero"`
+	Tags       []string  `json:"tags,omitempty"`
+	Language   string    `json:"language,omitempty"` // BCP 47 tag, e.g. "en" or "pt-BR"
+}
+
+// SendRecords sends structured sentences to the NexGenomics cloud. Records
+// are chunked by their encoded size in the same way as SendSentences, and a
+// failure is reported as a *SendError whose ranges index into records.
+// The Webhook's framing option does not apply; records are always sent as
+// JSON Lines.
+func (wh *Webhook) SendRecords(ctx context.Context, records []Sentence) error {
+	b, e := wh.record_batch(records)
+	if e != nil {
+		return e
+	}
+	return wh.send_records(ctx, b)
+}
@@ -0,0 +1,62 @@
+package nexgenomics_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+func TestSendRecords(t *testing.T) {
+	var ctype string
+	got := []nexgenomics.Sentence{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctype = r.Header.Get("Content-Type")
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var s nexgenomics.Sentence
+			if e := json.Unmarshal(sc.Bytes(), &s); e != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			got = append(got, s)
+		}
+	}))
+	defer srv.Close()
+
+	ts := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	records := []nexgenomics.Sentence{
+		{Text: "This is thing 1", DocumentId: "doc-1", Timestamp: ts, Tags: []string{"a", "b"}, Language: "en"},
+		{Text: "This is\nthing 2"},
+	}
+
+	h := nexgenomics.NewWebhook("abc", nexgenomics.WithBaseURL(srv.URL))
+	if e := h.SendRecords(context.Background(), records); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if ctype != nexgenomics.ContentTypeRecords {
+		t.Errorf("unexpected content type %q", ctype)
+	}
+	if len(got) != 2 || got[0].DocumentId != "doc-1" || !got[0].Timestamp.Equal(ts) || got[1].Text != "This is\nthing 2" {
+		t.Errorf("unexpected records %+v", got)
+	}
+
+	// a record that cannot be encoded fails the upload before anything is sent.
+	got = got[:0]
+	bad := []nexgenomics.Sentence{
+		{Text: "fine"},
+		{Text: "from the far future", Timestamp: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if e := h.SendRecords(context.Background(), bad); e == nil || !strings.Contains(e.Error(), "sentence 1") {
+		t.Errorf("expected an encoding error for sentence 1, got %v", e)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected nothing sent, got %+v", got)
+	}
+}
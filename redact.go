@@ -0,0 +1,139 @@
+package nexgenomics
+
+import (
+	"regexp"
+)
+
+// Redactor removes sensitive text from a sentence before it leaves the
+// process. Redact returns the cleaned text and how many redactions it made.
+type Redactor interface {
+	Name() string
+	Redact(s string) (string, int)
+}
+
+// RedactionReport tells the audit function what was redacted from one chunk.
+type RedactionReport struct {
+	SentenceRange
+	Counts map[string]int // redactions by Redactor name; empty if nothing was redacted
+}
+
+// WithRedactors runs every sentence through the redactors, in order, before
+// it is encoded. The redactors apply to the Text of structured records too.
+func WithRedactors(r ...Redactor) WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.redactors = append(wh.redactors, r...)
+	})
+}
+
+// WithRedactionAudit calls fn once for each chunk, before the chunk is sent,
+// with the number of redactions made in it. Calls are made one at a time,
+// in chunk order.
+func WithRedactionAudit(fn func(RedactionReport)) WebhookOption {
+	return webhook_option(func(wh *Webhook) {
+		wh.audit = fn
+	})
+}
+
+// RegexRedactor replaces every match of a regular expression.
+type RegexRedactor struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+}
+
+// NewRegexRedactor returns a redactor that replaces matches of pattern with
+// replacement, which may refer to submatches as in regexp.Expand.
+func NewRegexRedactor(name string, pattern string, replacement string) (*RegexRedactor, error) {
+	re, e := regexp.Compile(pattern)
+	if e != nil {
+		return nil, e
+	}
+	return &RegexRedactor{name: name, re: re, replacement: replacement}, nil
+}
+
+// must_regex_redactor is for the built-in patterns, which are known to compile.
+func must_regex_redactor(name string, pattern string, replacement string) *RegexRedactor {
+	r, e := NewRegexRedactor(name, pattern, replacement)
+	if e != nil {
+		panic(e)
+	}
+	return r
+}
+
+// Name
+func (r *RegexRedactor) Name() string {
+	return r.name
+}
+
+// Redact expands the replacement against the whole of s, so patterns that
+// look at the text around a match, such as \b or ^, behave as in
+// regexp.ReplaceAllString.
+func (r *RegexRedactor) Redact(s string) (string, int) {
+	matches := r.re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, 0
+	}
+	var out []byte
+	last := 0
+	for _, m := range matches {
+		out = append(out, s[last:m[0]]...)
+		out = r.re.ExpandString(out, r.replacement, s, m)
+		last = m[1]
+	}
+	out = append(out, s[last:]...)
+	return string(out), len(matches)
+}
+
+// Built-in redactors. They err on the side of redacting too much.
+var (
+	// EmailRedactor replaces email addresses with [EMAIL].
+	EmailRedactor = must_regex_redactor("email",
+		`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`, "[EMAIL]")
+
+	// NationalIDRedactor replaces US social security numbers and UK
+	// national insurance numbers with [NATIONAL_ID].
+	NationalIDRedactor = must_regex_redactor("national_id",
+		`\b\d{3}-\d{2}-\d{4}\b|\b[A-CEGHJ-PR-TW-Z]{2} ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`, "[NATIONAL_ID]")
+
+	// PhoneRedactor replaces phone numbers written with separators, with or
+	// without a country code, such as +1 415-555-0100, (415) 555 0100 or
+	// 020 7946 0958, with [PHONE].
+	PhoneRedactor = must_regex_redactor("phone",
+		`(?:\+\d{1,3}[\s.-]?)?\(?\b\d{2,4}\)?[\s.-]\d{3,4}[\s.-]?\d{4}\b`, "[PHONE]")
+)
+
+// DefaultRedactors returns the built-in redactors in the order they should run.
+func DefaultRedactors() []Redactor {
+	return []Redactor{EmailRedactor, NationalIDRedactor, PhoneRedactor}
+}
+
+// redact runs s through the Webhook's redactors. counts is nil if nothing
+// was redacted.
+func (wh *Webhook) redact(s string) (string, map[string]int) {
+	var counts map[string]int
+	for _, r := range wh.redactors {
+		var n int
+		s, n = r.Redact(s)
+		if n > 0 {
+			if counts == nil {
+				counts = map[string]int{}
+			}
+			counts[r.Name()] += n
+		}
+	}
+	return s, counts
+}
+
+// report_redactions passes the redactions in a chunk to the audit function.
+func (wh *Webhook) report_redactions(b *batch, ch chunk) {
+	if wh.audit == nil {
+		return
+	}
+	counts := map[string]int{}
+	for i := ch.Start; i < ch.End && i < len(b.redactions); i++ {
+		for k, v := range b.redactions[i] {
+			counts[k] += v
+		}
+	}
+	wh.audit(RedactionReport{SentenceRange: b.map_range(ch.SentenceRange), Counts: counts})
+}
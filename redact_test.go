@@ -0,0 +1,72 @@
+package nexgenomics_test
+
+import (
+	"testing"
+
+	"github.com/nexgenomics/go-nexgenomics"
+	"github.com/nexgenomics/go-nexgenomics/nexgenomicstest"
+)
+
+func TestRedactors(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+
+	ids, e := nexgenomics.NewRegexRedactor("patient", `PT-\d+`, "[PATIENT]")
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	reports := []nexgenomics.RedactionReport{}
+	opts := append(srv.WebhookOptions(),
+		nexgenomics.WithRedactors(nexgenomics.DefaultRedactors()...),
+		nexgenomics.WithRedactors(ids),
+		nexgenomics.WithRedactionAudit(func(r nexgenomics.RedactionReport) {
+			reports = append(reports, r)
+		}))
+	h := nexgenomics.NewWebhook("abc", opts...)
+
+	sentences := []string{
+		"Contact jane.doe@example.org or +1 415-555-0100 about PT-20931.",
+		"SSN 123-45-6789, NI AB 12 34 56 C, call (020) 7946 0958.",
+		"Variant rs429358 on chromosome 19 at position 44908684.",
+	}
+	if e := h.SendSentences(sentences...); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	want := []string{
+		"Contact [EMAIL] or [PHONE] about [PATIENT].",
+		"SSN [NATIONAL_ID], NI [NATIONAL_ID], call [PHONE].",
+		"Variant rs429358 on chromosome 19 at position 44908684.",
+	}
+	got := srv.Sentences()
+	for i := range want {
+		if i >= len(got) || got[i] != want[i] {
+			t.Errorf("sentence %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	if len(reports) != 1 {
+		t.Fatalf("expected one report per chunk, got %v", reports)
+	}
+	c := reports[0].Counts
+	if c["email"] != 1 || c["phone"] != 2 || c["national_id"] != 2 || c["patient"] != 1 {
+		t.Errorf("unexpected counts %v", c)
+	}
+}
+
+func TestRegexRedactorContext(t *testing.T) {
+	acct, e := nexgenomics.NewRegexRedactor("acct", `\Bacct(\d+)`, "[ACCT ${1}]")
+	if e != nil {
+		t.Fatalf("%s", e)
+	}
+	s, n := acct.Redact("xacct12345 here, acct999 not")
+	if s != "x[ACCT 12345] here, acct999 not" || n != 1 {
+		t.Errorf("got %q, %d", s, n)
+	}
+
+	line, _ := nexgenomics.NewRegexRedactor("line", `^MRN \d+`, "[MRN]")
+	if s, n := line.Redact("MRN 42 and MRN 43"); s != "[MRN] and MRN 43" || n != 1 {
+		t.Errorf("got %q, %d", s, n)
+	}
+}
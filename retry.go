@@ -0,0 +1,133 @@
+package nexgenomics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried. Requests are retried
+// on network errors, 408, 429 and 5xx responses, with exponential backoff and
+// jitter between attempts. A Retry-After header on a 429 or 503 response
+// takes precedence over the computed backoff when it asks for a longer wait.
+// Errors from the TokenSource are not retried.
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts, including the first. Values below 2 disable retries.
+	InitialBackoff time.Duration // delay before the first retry
+	MaxBackoff     time.Duration // upper bound on the computed delay
+}
+
+// DefaultRetryPolicy is a reasonable policy for batch ingest jobs.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     15 * time.Second,
+}
+
+// NoRetry makes a single attempt. It is the default.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// do calls fn until it succeeds, returns an error that is not worth retrying,
+// runs out of attempts or ctx is done.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		e := fn()
+		if e == nil || attempt >= p.MaxAttempts {
+			return e
+		}
+		retry, after := retryable(e)
+		if !retry {
+			return e
+		}
+
+		d := p.backoff(attempt)
+		if after > d {
+			d = after
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return e
+		case <-t.C:
+		}
+	}
+}
+
+// backoff returns the delay before the given retry, doubling from
+// InitialBackoff and capped at MaxBackoff, with "equal jitter" so that
+// concurrent clients spread out.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	if d <= 0 {
+		d = DefaultRetryPolicy.InitialBackoff
+	}
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	half := d / 2
+	return half + mrand.N(half+1)
+}
+
+// retryable classifies an error returned by a request, along with any delay
+// the server asked for.
+func retryable(e error) (bool, time.Duration) {
+	if errors.Is(e, context.Canceled) || errors.Is(e, context.DeadlineExceeded) {
+		return false, 0
+	}
+	var te *token_error
+	if errors.As(e, &te) {
+		// the source will not do better a moment later.
+		return false, 0
+	}
+	var rl *RateLimitError
+	if errors.As(e, &rl) {
+		return true, rl.RetryAfter
+	}
+	var ae *APIError
+	if errors.As(e, &ae) {
+		switch {
+		case ae.StatusCode == 503:
+			return true, parse_retry_after(ae.Header.Get("Retry-After"))
+		case ae.StatusCode == 408, ae.StatusCode >= 500:
+			return true, 0
+		default:
+			return false, 0
+		}
+	}
+	// transport errors: connection refused, reset, DNS and the like.
+	return true, 0
+}
+
+// parse_retry_after reads a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parse_retry_after(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if s, e := strconv.Atoi(h); e == nil && s >= 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, e := http.ParseTime(h); e == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// new_idempotency_key returns a random key that lets the server discard
+// duplicate deliveries of the same chunk.
+func new_idempotency_key() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
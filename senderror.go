@@ -0,0 +1,78 @@
+package nexgenomics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SentenceRange is a half-open span [Start, End) of indexes into the
+// sentences passed to SendSentences.
+type SentenceRange struct {
+	Start int
+	End   int
+}
+
+// ErrNotSent is the error of a chunk that was prepared but not sent because
+// an earlier chunk had already failed.
+var ErrNotSent = errors.New("not sent after an earlier failure")
+
+// ChunkFailure describes a chunk that the server did not accept.
+type ChunkFailure struct {
+	SentenceRange
+	Status int    // HTTP status of the last attempt, or zero if there was no response
+	Body   string // response body of the last attempt
+	Err    error
+}
+
+// SendError is returned by SendSentences when some chunks were not accepted.
+// No new chunks are started after the first failure, so every sentence from
+// Resume() onwards should be sent again. Chunks that were already prepared
+// when the upload stopped are reported in Failed with ErrNotSent. With
+// concurrent uploads, chunks that were already in flight may also appear in
+// Accepted or Failed; both lists are in sentence order.
+type SendError struct {
+	Accepted []SentenceRange
+	Failed   []ChunkFailure
+}
+
+// Error
+func (e *SendError) Error() string {
+	parts := []string{}
+	for _, f := range e.Failed {
+		parts = append(parts, fmt.Sprintf("sentences [%d,%d): %v", f.Start, f.End, f.Err))
+	}
+	return fmt.Sprintf("%d chunks accepted, %d failed: %s", len(e.Accepted), len(e.Failed), strings.Join(parts, "; "))
+}
+
+// Unwrap exposes the chunk errors to errors.Is and errors.As.
+func (e *SendError) Unwrap() []error {
+	errs := []error{}
+	for _, f := range e.Failed {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// Resume returns the index of the first sentence that was not accepted.
+func (e *SendError) Resume() int {
+	if len(e.Failed) > 0 {
+		return e.Failed[0].Start
+	}
+	if n := len(e.Accepted); n > 0 {
+		return e.Accepted[n-1].End
+	}
+	return 0
+}
+
+// fail records a failed chunk, pulling the status and body out of err when
+// the server responded.
+func (e *SendError) fail(r SentenceRange, err error) {
+	f := ChunkFailure{SentenceRange: r, Err: err}
+	var ae *APIError
+	if errors.As(err, &ae) {
+		f.Status = ae.StatusCode
+		f.Body = ae.Body
+	}
+	e.Failed = append(e.Failed, f)
+}
@@ -0,0 +1,197 @@
+package nexgenomics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is how long a SentenceWriter holds buffered sentences
+// before sending them, unless changed with WithFlushInterval.
+const DefaultFlushInterval = 5 * time.Second
+
+// SentenceWriter buffers sentences produced one at a time and sends them to
+// the Webhook in chunks. A chunk is sent when the buffer reaches the blob size
+// limit, when the flush interval expires, or when the writer is flushed or
+// closed. A SentenceWriter is safe for concurrent use.
+type SentenceWriter struct {
+	wh       *Webhook
+	ctx      context.Context
+	interval time.Duration
+
+	mu      sync.Mutex
+	buf     batch
+	buflen  int
+	seen    map[[32]byte]bool // hashes in buf, so duplicates are skipped until the next flush
+	partial []byte
+	timer   *time.Timer
+	errs    []error
+	closed  bool
+}
+
+// SentenceWriterOption configures a SentenceWriter.
+type SentenceWriterOption func(*SentenceWriter)
+
+// WithFlushInterval sets how long sentences may wait in the buffer before
+// they are sent. Zero disables timed flushes.
+func WithFlushInterval(d time.Duration) SentenceWriterOption {
+	return func(sw *SentenceWriter) {
+		sw.interval = d
+	}
+}
+
+// NewSentenceWriter returns a SentenceWriter that sends through the Webhook.
+// The context applies to every chunk the writer sends.
+func (wh *Webhook) NewSentenceWriter(ctx context.Context, opts ...SentenceWriterOption) *SentenceWriter {
+	sw := &SentenceWriter{
+		wh:       wh,
+		ctx:      ctx,
+		interval: DefaultFlushInterval,
+	}
+	for _, o := range opts {
+		o(sw)
+	}
+	return sw
+}
+
+// Add appends a single sentence to the buffer, sending the buffer if it has
+// reached the size limit.
+func (sw *SentenceWriter) Add(s string) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return errors.New("sentence writer closed")
+	}
+	return sw.add(s)
+}
+
+// Write implements io.Writer. Each newline-terminated line is added as a
+// sentence; a trailing partial line is held until the rest of it arrives or
+// the writer is closed.
+func (sw *SentenceWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return 0, errors.New("sentence writer closed")
+	}
+
+	sw.partial = append(sw.partial, p...)
+	for {
+		i := bytes.IndexByte(sw.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(sw.partial[:i])
+		sw.partial = sw.partial[i+1:]
+		if e := sw.add(line); e != nil {
+			return len(p), e
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends whatever is in the buffer.
+func (sw *SentenceWriter) Flush() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	return sw.flush()
+}
+
+// Close flushes the buffer, including any partial line given to Write, and
+// returns the errors from every send that failed during the writer's life.
+func (sw *SentenceWriter) Close() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+
+	if len(sw.partial) > 0 {
+		if e := sw.add_record(string(sw.partial)); e != nil {
+			sw.errs = append(sw.errs, e)
+		}
+		sw.partial = nil
+	}
+	if e := sw.flush(); e != nil {
+		sw.errs = append(sw.errs, e)
+	}
+	return errors.Join(sw.errs...)
+}
+
+// add ASSUMES the lock is held.
+func (sw *SentenceWriter) add(s string) error {
+	if e := sw.add_record(s); e != nil {
+		return e
+	}
+
+	if sw.buflen >= sw.wh.flush_threshold() {
+		if e := sw.flush(); e != nil {
+			sw.errs = append(sw.errs, e)
+			return e
+		}
+		return nil
+	}
+
+	if sw.timer == nil && sw.interval > 0 {
+		sw.timer = time.AfterFunc(sw.interval, sw.timed_flush)
+	}
+	return nil
+}
+
+// add_record encodes a sentence into the buffer, applying the Webhook's
+// oversize policy. It ASSUMES the lock is held.
+func (sw *SentenceWriter) add_record(s string) error {
+	if sw.seen == nil {
+		sw.seen = map[[32]byte]bool{}
+	}
+	b, e := sw.wh.sentence_batch([]string{s}, sw.seen)
+	if e != nil {
+		return e
+	}
+	sw.buf.append(b)
+	for _, r := range b.records {
+		sw.buflen += len(r) + len(b.sep)
+	}
+	return nil
+}
+
+// flush ASSUMES the lock is held.
+func (sw *SentenceWriter) flush() error {
+	if sw.timer != nil {
+		sw.timer.Stop()
+		sw.timer = nil
+	}
+	b := sw.buf
+	sw.buf = batch{}
+	sw.buflen = 0
+	sw.seen = nil
+	if len(b.records) == 0 {
+		sw.wh.skipped.Add(int64(b.skipped))
+		return nil
+	}
+
+	b.content_type = sw.wh.framing.content_type()
+	b.sep = sw.wh.framing.separator()
+	return sw.wh.send_records(sw.ctx, &b)
+}
+
+// timed_flush runs on the timer's goroutine. Its errors are reported by Close.
+func (sw *SentenceWriter) timed_flush() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return
+	}
+	sw.timer = nil
+	if e := sw.flush(); e != nil {
+		sw.errs = append(sw.errs, e)
+	}
+}
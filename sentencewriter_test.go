@@ -0,0 +1,73 @@
+package nexgenomics_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+func TestSentenceWriter(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	h := nexgenomics.NewWebhook("abc", nexgenomics.WithBaseURL(srv.URL))
+	sw := h.NewSentenceWriter(context.Background(), nexgenomics.WithFlushInterval(0))
+
+	fmt.Fprintf(sw, "This is thing 1\nThis is ")
+	fmt.Fprintf(sw, "thing 2\nThis is thing 3")
+	if e := sw.Add("This is thing 4"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if len(bodies) != 0 {
+		t.Fatalf("sent before close: %q", bodies)
+	}
+	if e := sw.Close(); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	want := "This is thing 1\nThis is thing 2\nThis is thing 4\nThis is thing 3"
+	if len(bodies) != 1 || bodies[0] != want {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+	if e := sw.Add("late"); e == nil {
+		t.Errorf("expected an error adding to a closed writer")
+	}
+}
+
+func TestSentenceWriterInterval(t *testing.T) {
+	sent := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		sent <- string(b)
+	}))
+	defer srv.Close()
+
+	h := nexgenomics.NewWebhook("abc", nexgenomics.WithBaseURL(srv.URL))
+	sw := h.NewSentenceWriter(context.Background(), nexgenomics.WithFlushInterval(10*time.Millisecond))
+	defer sw.Close()
+
+	sw.Add(strings.Repeat("x", 10))
+	select {
+	case b := <-sent:
+		if b != strings.Repeat("x", 10) {
+			t.Errorf("unexpected body %q", b)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("timed flush never happened")
+	}
+}
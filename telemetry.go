@@ -0,0 +1,176 @@
+package nexgenomics
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation_name identifies the SDK to tracer and meter providers.
+const instrumentation_name = "github.com/nexgenomics/go-nexgenomics"
+
+// WithTracerProvider records a span for every request through tp. Without
+// it the global provider is used, which does nothing unless the program
+// has installed one with otel.SetTracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *conn) {
+		c.tracer = tp
+	}
+}
+
+// WithMeterProvider records request metrics through mp. Without it the
+// global provider is used.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *conn) {
+		c.meter = mp
+	}
+}
+
+// telemetry holds a client's tracer and metric instruments.
+//
+// Every request is a span named after the service, method and path, with
+// one child per webhook chunk. The W3C trace context of the span is sent
+// in the request headers. The metrics are:
+//
+//	nexgenomics.client.request.duration  histogram of attempt latency, in seconds
+//	nexgenomics.client.request.size      counter of request body bytes sent
+//	nexgenomics.client.response.size     counter of response body bytes received
+//	nexgenomics.client.errors            counter of failed attempts
+type telemetry struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	sent     metric.Int64Counter
+	received metric.Int64Counter
+	errors   metric.Int64Counter
+}
+
+// new_telemetry builds the instruments. Errors from the meter are ignored:
+// it still returns usable instruments, and telemetry must never stop a
+// request.
+func new_telemetry(tp trace.TracerProvider, mp metric.MeterProvider) *telemetry {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	m := mp.Meter(instrumentation_name)
+
+	t := &telemetry{tracer: tp.Tracer(instrumentation_name)}
+	t.duration, _ = m.Float64Histogram("nexgenomics.client.request.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of each request attempt."))
+	t.sent, _ = m.Int64Counter("nexgenomics.client.request.size",
+		metric.WithUnit("By"), metric.WithDescription("Request body bytes sent."))
+	t.received, _ = m.Int64Counter("nexgenomics.client.response.size",
+		metric.WithUnit("By"), metric.WithDescription("Response body bytes received."))
+	t.errors, _ = m.Int64Counter("nexgenomics.client.errors",
+		metric.WithUnit("{error}"), metric.WithDescription("Request attempts that failed."))
+	return t
+}
+
+// telemetry returns the client's instruments, falling back to the global
+// providers for clients that were made as struct literals.
+func (c *conn) telemetry() *telemetry {
+	if c.tel == nil {
+		return new_telemetry(nil, nil)
+	}
+	return c.tel
+}
+
+// start_request opens the span that covers a request and all its retries.
+func (c *conn) start_request(ctx context.Context, method string, u string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("nexgenomics.service", c.service),
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", u),
+	}
+	name := c.service + " " + method
+	if p, e := url.Parse(u); e == nil {
+		name += " " + p.Path
+		attrs = append(attrs, attribute.String("server.address", p.Hostname()))
+	}
+	return c.telemetry().tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+}
+
+// start_chunk opens the span for one webhook chunk.
+func (c *conn) start_chunk(ctx context.Context, index int, r SentenceRange, size int) (context.Context, trace.Span) {
+	return c.telemetry().tracer.Start(ctx, "webhook chunk",
+		trace.WithAttributes(
+			attribute.Int("nexgenomics.chunk.index", index),
+			attribute.Int("nexgenomics.chunk.start", r.Start),
+			attribute.Int("nexgenomics.chunk.end", r.End),
+			attribute.Int("nexgenomics.chunk.size", size)))
+}
+
+// end_span records the outcome of an operation on its span and ends it.
+func end_span(span trace.Span, e error) {
+	if e != nil {
+		span.RecordError(e)
+		span.SetStatus(codes.Error, e.Error())
+	}
+	span.End()
+}
+
+// inject writes the trace context of ctx into the request headers.
+func inject(ctx context.Context, req *resty.Request) {
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
+
+// observe_attempt records the metrics for one attempt. resp is nil when
+// the request never got a response.
+func (c *conn) observe_attempt(ctx context.Context, method string, start time.Time, sent int, resp *resty.Response, e error) {
+	t := c.telemetry()
+	attrs := []attribute.KeyValue{
+		attribute.String("nexgenomics.service", c.service),
+		attribute.String("http.request.method", method),
+	}
+	if resp != nil {
+		attrs = append(attrs, attribute.Int("http.response.status_code", resp.StatusCode()))
+	}
+	set := metric.WithAttributes(attrs...)
+
+	t.duration.Record(ctx, time.Since(start).Seconds(), set)
+	t.sent.Add(ctx, int64(sent), set)
+	if resp != nil {
+		t.received.Add(ctx, int64(len(resp.Body())), set)
+	}
+	if e != nil {
+		t.errors.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String("error.type", error_type(e)))...))
+	}
+}
+
+// error_type classifies an error for the error.type attribute.
+func error_type(e error) string {
+	var api *APIError
+	switch {
+	case errors.Is(e, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(e, context.Canceled):
+		return "canceled"
+	case errors.As(e, &api):
+		return strconv.Itoa(api.StatusCode)
+	}
+	return "transport"
+}
+
+// body_size returns the size of a request body set by a build function.
+// Bodies are always byte slices or values that resty marshals itself; the
+// latter are not counted.
+func body_size(req *resty.Request) int {
+	if b, ok := req.Body.([]byte); ok {
+		return len(b)
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package nexgenomics_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nexgenomics/go-nexgenomics"
+	"github.com/nexgenomics/go-nexgenomics/nexgenomicstest"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTelemetry(t *testing.T) {
+	srv := nexgenomicstest.NewServer()
+	defer srv.Close()
+	srv.AllowTokens("tok")
+
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	opts := append(srv.WebhookOptions(),
+		nexgenomics.WithTracerProvider(tp),
+		nexgenomics.WithMeterProvider(mp),
+		nexgenomics.WithMaxChunkSize(6),
+	)
+	h := nexgenomics.NewWebhook("tok", opts...)
+	if e := h.SendSentences("one", "two"); e != nil {
+		t.Fatalf("%s", e)
+	}
+
+	// one chunk span and one request span per chunk, and the request span
+	// is the one the server sees.
+	var chunks, requests int
+	parents := map[string]bool{}
+	for _, s := range spans.Ended() {
+		switch {
+		case s.Name() == "webhook chunk":
+			chunks++
+		case s.Name() == "webhook POST /wh/sentences":
+			requests++
+			parents[s.SpanContext().SpanID().String()] = true
+		}
+	}
+	if chunks != 2 || requests != 2 {
+		t.Errorf("expected 2 chunk and 2 request spans, got %d and %d", chunks, requests)
+	}
+	for _, r := range srv.Requests() {
+		tp := strings.Split(r.Header.Get("Traceparent"), "-")
+		if len(tp) != 4 || !parents[tp[2]] {
+			t.Errorf("traceparent %q does not name a request span", r.Header.Get("Traceparent"))
+		}
+	}
+
+	// a failed request is counted as an error.
+	srv.Fail(nexgenomicstest.Failure{Path: "/wh/sentences", Status: http.StatusBadRequest})
+	h.SendSentences("three")
+
+	var rm metricdata.ResourceMetrics
+	if e := reader.Collect(context.Background(), &rm); e != nil {
+		t.Fatalf("%s", e)
+	}
+	sums := map[string]int64{}
+	var attempts uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch d := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, p := range d.DataPoints {
+					sums[m.Name] += p.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, p := range d.DataPoints {
+					attempts += p.Count
+				}
+			}
+		}
+	}
+	if attempts != 3 || sums["nexgenomics.client.errors"] != 1 || sums["nexgenomics.client.request.size"] != int64(len("one"+"two"+"three")) {
+		t.Errorf("unexpected metrics: %d attempts, %v", attempts, sums)
+	}
+}
@@ -0,0 +1,164 @@
+package nexgenomics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource supplies the bearer token for each request. Clients ask for
+// the token every time they make a request, so a source may rotate it freely.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenRefresher is implemented by sources that can fetch a fresh token on
+// demand. After a 401 or 403, a client whose source is a TokenRefresher
+// refreshes it and retries the request once.
+type TokenRefresher interface {
+	Refresh(ctx context.Context) (string, error)
+}
+
+// token_error is a failure of the TokenSource. It is not retried.
+type token_error struct {
+	err error
+}
+
+// Error
+func (e *token_error) Error() string {
+	return "token: " + e.err.Error()
+}
+
+// Unwrap
+func (e *token_error) Unwrap() error {
+	return e.err
+}
+
+// WithTokenSource makes the client take its token from ts rather than from
+// its Token field.
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *conn) {
+		c.tokens = ts
+	}
+}
+
+// StaticToken returns a source that always supplies tok.
+func StaticToken(tok string) TokenSource {
+	return static_token(tok)
+}
+
+type static_token string
+
+func (t static_token) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// EnvToken returns a source that reads the environment variable name on
+// every request.
+func EnvToken(name string) TokenSource {
+	return env_token(name)
+}
+
+type env_token string
+
+func (t env_token) Token(context.Context) (string, error) {
+	tok := strings.TrimSpace(os.Getenv(string(t)))
+	if tok == "" {
+		return "", fmt.Errorf("environment variable %s is not set", string(t))
+	}
+	return tok, nil
+}
+
+func (t env_token) Refresh(ctx context.Context) (string, error) {
+	return t.Token(ctx)
+}
+
+// FileTokenSource reads a token from a file, such as one a secrets manager
+// keeps up to date. The file is checked on every request and read again
+// whenever its size or modification time changes. Surrounding whitespace
+// is ignored.
+type FileTokenSource struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modtime time.Time
+	size    int64
+}
+
+// FileToken returns a FileTokenSource for path.
+func FileToken(path string) *FileTokenSource {
+	return &FileTokenSource{path: path}
+}
+
+// Token
+func (f *FileTokenSource) Token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, e := os.Stat(f.path)
+	if e != nil {
+		return "", e
+	}
+	if f.token != "" && fi.ModTime().Equal(f.modtime) && fi.Size() == f.size {
+		return f.token, nil
+	}
+	return f.read(fi)
+}
+
+// Refresh reads the file again even if it looks unchanged.
+func (f *FileTokenSource) Refresh(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, e := os.Stat(f.path)
+	if e != nil {
+		return "", e
+	}
+	return f.read(fi)
+}
+
+// read ASSUMES the lock is held.
+func (f *FileTokenSource) read(fi os.FileInfo) (string, error) {
+	data, e := os.ReadFile(f.path)
+	if e != nil {
+		return "", e
+	}
+	tok := strings.TrimSpace(string(data))
+	if tok == "" {
+		return "", fmt.Errorf("token file %s is empty", f.path)
+	}
+	f.token = tok
+	f.modtime = fi.ModTime()
+	f.size = fi.Size()
+	return tok, nil
+}
+
+// token_source returns the client's TokenSource, or its static token.
+func (c *conn) token_source(static string) TokenSource {
+	if c.tokens != nil {
+		return c.tokens
+	}
+	return StaticToken(static)
+}
+
+// authorized runs fn, and if it fails with ErrUnauthorized and ts can be
+// refreshed, refreshes ts and runs fn once more.
+func authorized(ctx context.Context, ts TokenSource, fn func() error) error {
+	e := fn()
+	if !errors.Is(e, ErrUnauthorized) {
+		return e
+	}
+	r, ok := ts.(TokenRefresher)
+	if !ok {
+		return e
+	}
+	if _, re := r.Refresh(ctx); re != nil {
+		return e
+	}
+	return fn()
+}
@@ -0,0 +1,93 @@
+package nexgenomics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+// rotating is a TokenSource whose token only changes when it is refreshed.
+type rotating struct {
+	tokens    []string
+	refreshes int
+}
+
+func (r *rotating) Token(context.Context) (string, error) {
+	return r.tokens[r.refreshes], nil
+}
+
+func (r *rotating) Refresh(context.Context) (string, error) {
+	r.refreshes++
+	return r.tokens[r.refreshes], nil
+}
+
+func TestTokenSource(t *testing.T) {
+	valid := "tok-1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	// A file that is rewritten is picked up on the next request.
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("tok-1\n"), 0o600)
+	h := nexgenomics.NewWebhook("", nexgenomics.WithBaseURL(srv.URL), nexgenomics.WithTokenSource(nexgenomics.FileToken(path)))
+	if e := h.SendSentences("one"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	valid = "tok-22"
+	os.WriteFile(path, []byte("tok-22\n"), 0o600)
+	if e := h.SendSentences("two"); e != nil {
+		t.Errorf("rotated file token: %s", e)
+	}
+
+	// A 401 refreshes the source and retries once.
+	r := &rotating{tokens: []string{"stale", "tok-22", "never"}}
+	h = nexgenomics.NewWebhook("", nexgenomics.WithBaseURL(srv.URL), nexgenomics.WithTokenSource(r))
+	if e := h.SendSentences("three"); e != nil || r.refreshes != 1 {
+		t.Errorf("expected one refresh and success, got %d refreshes and %v", r.refreshes, e)
+	}
+
+	// ...but only once.
+	valid = "tok-333"
+	r = &rotating{tokens: []string{"stale", "also stale", "never"}}
+	h = nexgenomics.NewWebhook("", nexgenomics.WithBaseURL(srv.URL), nexgenomics.WithTokenSource(r))
+	if e := h.SendSentences("four"); !errors.Is(e, nexgenomics.ErrUnauthorized) || r.refreshes != 1 {
+		t.Errorf("expected ErrUnauthorized after one refresh, got %d refreshes and %v", r.refreshes, e)
+	}
+
+	t.Setenv("NEXGENOMICS_TEST_TOKEN", "tok-333")
+	h = nexgenomics.NewWebhook("", nexgenomics.WithBaseURL(srv.URL), nexgenomics.WithTokenSource(nexgenomics.EnvToken("NEXGENOMICS_TEST_TOKEN")))
+	if e := h.SendSentences("five"); e != nil {
+		t.Errorf("env token: %s", e)
+	}
+}
+
+// failing is a TokenSource that never has a token.
+type failing struct {
+	calls int
+}
+
+func (f *failing) Token(context.Context) (string, error) {
+	f.calls++
+	return "", errors.New("no token")
+}
+
+func TestTokenSourceErrorNotRetried(t *testing.T) {
+	f := &failing{}
+	h := nexgenomics.NewWebhook("", nexgenomics.WithBaseURL("http://127.0.0.1:1"),
+		nexgenomics.WithTokenSource(f),
+		nexgenomics.WithRetry(nexgenomics.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}))
+	if e := h.SendSentences("one"); e == nil || f.calls != 1 {
+		t.Errorf("expected one attempt and an error, got %d attempts and %v", f.calls, e)
+	}
+}
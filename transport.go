@@ -0,0 +1,148 @@
+package nexgenomics
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ConnectionPool sizes the pool of connections a client keeps. Zero fields
+// keep the defaults of http.DefaultTransport.
+type ConnectionPool struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+}
+
+// transport collects the transport options. The transport itself is built
+// once by finish, so every cloud client connects the same way.
+//
+// The transport options have no effect on a client given WithHTTPClient,
+// whose transport is never modified.
+type transport struct {
+	proxy    *url.URL
+	direct   bool
+	roots    []*x509.Certificate
+	certs    []tls.Certificate
+	no_http2 bool
+	pool     ConnectionPool
+}
+
+// transport_option changes a copy of the transport options, so that a
+// Client's options are not changed by those given to one of its sub-clients.
+func transport_option(f func(*transport)) Option {
+	return func(c *conn) {
+		t := transport{}
+		if c.transport != nil {
+			t = *c.transport
+			t.roots = slices.Clone(t.roots)
+			t.certs = slices.Clone(t.certs)
+		}
+		f(&t)
+		c.transport = &t
+	}
+}
+
+// WithProxy sends requests through the HTTP proxy at u. A nil u connects
+// directly. Without this option the proxy is taken from the HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY environment variables.
+func WithProxy(u *url.URL) Option {
+	return transport_option(func(t *transport) {
+		t.proxy = u
+		t.direct = u == nil
+	})
+}
+
+// WithRootCAs trusts certs as well as the system roots, for networks that
+// inspect TLS with a private certificate authority.
+func WithRootCAs(certs ...*x509.Certificate) Option {
+	return transport_option(func(t *transport) {
+		t.roots = append(t.roots, certs...)
+	})
+}
+
+// WithClientCertificate presents cert to servers that ask for one, for
+// mutual TLS. Load it with tls.LoadX509KeyPair.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return transport_option(func(t *transport) {
+		t.certs = append(t.certs, cert)
+	})
+}
+
+// WithHTTP2 turns HTTP/2 on or off. It is on by default; some proxies only
+// handle HTTP/1.1.
+func WithHTTP2(enabled bool) Option {
+	return transport_option(func(t *transport) {
+		t.no_http2 = !enabled
+	})
+}
+
+// WithConnectionPool sizes the client's connection pool.
+func WithConnectionPool(p ConnectionPool) Option {
+	return transport_option(func(t *transport) {
+		t.pool = p
+	})
+}
+
+// http_client builds an HTTP client from the options, starting from a copy
+// of http.DefaultTransport.
+func (t *transport) http_client() *http.Client {
+	ht := http.DefaultTransport.(*http.Transport).Clone()
+
+	if t.proxy != nil {
+		ht.Proxy = http.ProxyURL(t.proxy)
+	} else if t.direct {
+		ht.Proxy = nil
+	}
+
+	if len(t.roots) > 0 || len(t.certs) > 0 {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if len(t.roots) > 0 {
+			pool, e := x509.SystemCertPool()
+			if e != nil {
+				pool = x509.NewCertPool()
+			}
+			for _, c := range t.roots {
+				pool.AddCert(c)
+			}
+			cfg.RootCAs = pool
+		}
+		cfg.Certificates = t.certs
+		ht.TLSClientConfig = cfg
+	}
+
+	if t.no_http2 {
+		// a non-nil, empty map is how net/http is told not to negotiate h2.
+		ht.ForceAttemptHTTP2 = false
+		ht.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if t.pool.MaxIdleConns > 0 {
+		ht.MaxIdleConns = t.pool.MaxIdleConns
+	}
+	if t.pool.MaxIdleConnsPerHost > 0 {
+		ht.MaxIdleConnsPerHost = t.pool.MaxIdleConnsPerHost
+	}
+	if t.pool.MaxConnsPerHost > 0 {
+		ht.MaxConnsPerHost = t.pool.MaxConnsPerHost
+	}
+	if t.pool.IdleConnTimeout > 0 {
+		ht.IdleConnTimeout = t.pool.IdleConnTimeout
+	}
+
+	return &http.Client{Transport: ht}
+}
+
+// new_client returns the resty client for the options.
+func (t *transport) new_client() *resty.Client {
+	if t == nil {
+		return resty.New()
+	}
+	return resty.NewWithClient(t.http_client())
+}
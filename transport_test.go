@@ -0,0 +1,66 @@
+package nexgenomics_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/nexgenomics/go-nexgenomics"
+)
+
+func TestTransport(t *testing.T) {
+	var proto int
+	var clientcert bool
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.ProtoMajor
+		clientcert = len(r.TLS.PeerCertificates) > 0
+	}))
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the test server's certificate is not in the system roots.
+	h := nexgenomics.NewWebhook("tok", nexgenomics.WithBaseURL(srv.URL))
+	if e := h.SendSentences("one"); e == nil {
+		t.Errorf("expected an untrusted certificate to fail")
+	}
+
+	h = nexgenomics.NewWebhook("tok", nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithRootCAs(srv.Certificate()),
+		nexgenomics.WithConnectionPool(nexgenomics.ConnectionPool{MaxConnsPerHost: 2}))
+	if e := h.SendSentences("one"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if proto != 2 || clientcert {
+		t.Errorf("expected HTTP/2 without a client certificate, got HTTP/%d and %v", proto, clientcert)
+	}
+
+	h = nexgenomics.NewWebhook("tok", nexgenomics.WithBaseURL(srv.URL),
+		nexgenomics.WithRootCAs(srv.Certificate()),
+		nexgenomics.WithClientCertificate(srv.TLS.Certificates[0]),
+		nexgenomics.WithHTTP2(false))
+	if e := h.SendSentences("one"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if proto != 1 || !clientcert {
+		t.Errorf("expected HTTP/1.1 with a client certificate, got HTTP/%d and %v", proto, clientcert)
+	}
+
+	// requests for a plain HTTP host go to the proxy with the full URL.
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+	h = nexgenomics.NewWebhook("tok", nexgenomics.WithBaseURL("http://webhook.invalid"), nexgenomics.WithProxy(u))
+	if e := h.SendSentences("one"); e != nil {
+		t.Fatalf("%s", e)
+	}
+	if proxied != "http://webhook.invalid/wh/sentences" {
+		t.Errorf("proxy saw %q", proxied)
+	}
+}